@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/spf13/cobra"
+
+	"github.com/marc-watters/the-block-chain-bar/v2/database"
+	"github.com/marc-watters/the-block-chain-bar/v2/node"
+)
+
+func accountCmd() *cobra.Command {
+	accountCmd := &cobra.Command{
+		Use:   "account",
+		Short: "Inspects accounts",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return incorrectUsage()
+		},
+		Run: func(cmd *cobra.Command, args []string) {},
+	}
+
+	accountCmd.AddCommand(accountHistoryCmd())
+
+	return accountCmd
+}
+
+func accountHistoryCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "history <account>",
+		Short: "Lists the transfers and mining rewards of an account, oldest first",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if !common.IsHexAddress(args[0]) {
+				fmt.Fprintf(os.Stderr, "%s is an invalid account\n", args[0])
+				os.Exit(1)
+			}
+			account := database.NewAccount(args[0])
+
+			offset, err := cmd.Flags().GetUint64(flagOffset)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			limit, err := cmd.Flags().GetUint64(flagLimit)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			s, err := database.NewStateFromDisk(getDataDirFromCmd(cmd))
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			defer s.Close()
+
+			entries, total, err := s.AccountHistory(account, offset, limit)
+			if err != nil {
+				s.Close()
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("History of %s: %d of %d entries from offset %d\n", account.Hex(), len(entries), total, offset)
+
+			w := tabwriter.NewWriter(os.Stdout, 1, 1, 1, ' ', 0)
+			fmt.Fprintln(w, "HEIGHT\tKIND\tAMOUNT\tFEE\tCOUNTERPARTY\tTRX")
+			for _, e := range entries {
+				counterparty, trx := "-", "-"
+				if e.Kind != database.HistoryReward {
+					counterparty, trx = e.Counterparty.Hex(), e.TrxHash.Hex()
+				}
+				fmt.Fprintf(w, "%d\t%s\t%d\t%d\t%s\t%s\n", e.BlockHeight, e.Kind, e.Amount, e.Fee, counterparty, trx)
+			}
+			w.Flush()
+		},
+	}
+
+	addDefaultRequiredFlags(cmd)
+	cmd.Flags().Uint64(flagOffset, 0, "number of history entries to skip")
+	cmd.Flags().Uint64(flagLimit, node.DefaultHistoryLimit, "maximum number of history entries to list")
+
+	return cmd
+}
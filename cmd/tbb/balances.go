@@ -6,6 +6,7 @@ import (
 	"strings"
 	"text/tabwriter"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/spf13/cobra"
 
 	"github.com/marc-watters/the-block-chain-bar/v2/database"
@@ -31,6 +32,16 @@ func balancesListCmd() *cobra.Command {
 		Use:   "list",
 		Short: "Lists all balances",
 		Run: func(cmd *cobra.Command, args []string) {
+			accountRaw, err := cmd.Flags().GetString(flagAccount)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			if accountRaw != "" && !common.IsHexAddress(accountRaw) {
+				fmt.Fprintf(os.Stderr, "%s is an invalid account\n", accountRaw)
+				os.Exit(1)
+			}
+
 			s, err := database.NewStateFromDisk(getDataDirFromCmd(cmd))
 			if err != nil {
 				fmt.Fprintln(os.Stderr, err)
@@ -38,15 +49,35 @@ func balancesListCmd() *cobra.Command {
 			}
 			defer s.Close()
 
+			balances, blockHash := s.Balances(), s.LatestBlockHash()
+			if cmd.Flags().Changed(flagHeight) {
+				height, err := cmd.Flags().GetUint64(flagHeight)
+				if err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					os.Exit(1)
+				}
+
+				balances, blockHash, err = s.BalancesAt(height)
+				if err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					os.Exit(1)
+				}
+			}
+
+			if accountRaw != "" {
+				account := database.NewAccount(accountRaw)
+				balances = map[common.Address]uint64{account: balances[account]}
+			}
+
 			fmt.Println()
 			fmt.Printf("%s\n", strings.Repeat("=", 72))
 			fmt.Printf("%[1]s Account Balances %[1]s\n", strings.Repeat(" ", 27))
 			fmt.Printf("%s\n", strings.Repeat("=", 72))
-			fmt.Printf("%[1]s %x %[1]s\n", strings.Repeat("*", 3), s.LatestBlockHash())
+			fmt.Printf("%[1]s %x %[1]s\n", strings.Repeat("*", 3), blockHash)
 			fmt.Printf("%s\n", strings.Repeat("-", 72))
 
 			w := tabwriter.NewWriter(os.Stdout, 1, 1, 1, ' ', 0)
-			for account, balance := range s.Balances() {
+			for account, balance := range balances {
 				fmt.Fprintf(w, " |>\t%s\t%d\n", account.String(), balance)
 			}
 			w.Flush()
@@ -57,6 +88,8 @@ func balancesListCmd() *cobra.Command {
 	}
 
 	addDefaultRequiredFlags(cmd)
+	cmd.Flags().Uint64(flagHeight, 0, "list the balances as of the block at this height instead of the latest block")
+	cmd.Flags().String(flagAccount, "", "only list the balance of this account")
 
 	return cmd
 }
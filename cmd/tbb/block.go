@@ -0,0 +1,255 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/marc-watters/the-block-chain-bar/v2/database"
+	"github.com/marc-watters/the-block-chain-bar/v2/node"
+)
+
+func blockCmd() *cobra.Command {
+	blockCmd := &cobra.Command{
+		Use:   "block",
+		Short: "Shows mined blocks from a datadir or a node",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return incorrectUsage()
+		},
+		Run: func(cmd *cobra.Command, args []string) {},
+	}
+
+	blockCmd.AddCommand(blockShowCmd(), blockListCmd())
+
+	return blockCmd
+}
+
+func blockShowCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "show <height|hash>",
+		Short: "Shows a block's header, transactions and reward",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			nodeURL, _ := cmd.Flags().GetString(flagNode)
+			asJSON, _ := cmd.Flags().GetBool(flagJSON)
+
+			var res node.BlockRes
+			if nodeURL != "" {
+				if err := getNodeRes(nodeURL, "/blocks/"+url.PathEscape(args[0]), &res); err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					os.Exit(1)
+				}
+			} else {
+				s, err := database.NewStateFromDisk(getDataDirFromCmd(cmd))
+				if err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					os.Exit(1)
+				}
+				defer s.Close()
+
+				blockFS, err := s.GetBlockByRef(args[0])
+				if err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					os.Exit(1)
+				}
+
+				res, err = node.NewBlockRes(blockFS.Key, blockFS.Value, s.Confirmations(blockFS.Value.Header.Height))
+				if err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					os.Exit(1)
+				}
+			}
+
+			if asJSON {
+				printJSON(res)
+				return
+			}
+			printBlock(res)
+		},
+	}
+
+	addBlockSourceFlags(cmd)
+
+	return cmd
+}
+
+func blockListCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "Lists a range of blocks, one per line",
+		Run: func(cmd *cobra.Command, args []string) {
+			nodeURL, _ := cmd.Flags().GetString(flagNode)
+			asJSON, _ := cmd.Flags().GetBool(flagJSON)
+			from, _ := cmd.Flags().GetUint64(flagFrom)
+			to, _ := cmd.Flags().GetUint64(flagTo)
+			if !cmd.Flags().Changed(flagTo) {
+				to = math.MaxUint64
+			}
+
+			var res node.BlocksRes
+			var err error
+			if nodeURL != "" {
+				res, err = listNodeBlocks(nodeURL, from, to)
+			} else {
+				res, err = listLocalBlocks(getDataDirFromCmd(cmd), from, to)
+			}
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			if asJSON {
+				printJSON(res)
+				return
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 1, 1, 2, ' ', 0)
+			fmt.Fprintln(w, "HEIGHT\tHASH\tTIME\tMINER\tTRXS\tREWARD")
+			for _, b := range res.Blocks {
+				fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%d\t%d\n",
+					b.Block.Header.Height, b.Hash.Hex(), formatBlockTime(b.Block.Header.Time),
+					b.Block.Header.Miner.Hex(), len(b.Block.TRXs), b.Reward)
+			}
+			w.Flush()
+		},
+	}
+
+	addBlockSourceFlags(cmd)
+	cmd.Flags().Uint64(flagFrom, 0, "height of the first listed block")
+	cmd.Flags().Uint64(flagTo, 0, "height of the last listed block (the latest block by default)")
+
+	return cmd
+}
+
+// addBlockSourceFlags lets a command read blocks from a datadir or a node.
+func addBlockSourceFlags(cmd *cobra.Command) {
+	cmd.Flags().String(flagDataDir, "", "Absolute path to the node data directory to read the blocks from")
+	cmd.Flags().String(flagNode, "", fmt.Sprintf("URL of the node to read the blocks from, e.g. http://%s:%d", node.DefaultIP, node.DefaultHTTPort))
+	cmd.Flags().Bool(flagJSON, false, "print the blocks as JSON")
+	cmd.MarkFlagsOneRequired(flagDataDir, flagNode)
+	cmd.MarkFlagsMutuallyExclusive(flagDataDir, flagNode)
+}
+
+func listLocalBlocks(dataDir string, from, to uint64) (node.BlocksRes, error) {
+	res := node.BlocksRes{Blocks: make([]node.BlockRes, 0)}
+
+	s, err := database.NewStateFromDisk(dataDir)
+	if err != nil {
+		return res, err
+	}
+	defer s.Close()
+
+	blocks, err := s.GetBlocks(from, to)
+	if err != nil {
+		return res, err
+	}
+
+	for _, block := range blocks {
+		blockHash, err := block.Hash()
+		if err != nil {
+			return res, err
+		}
+
+		blockRes, err := node.NewBlockRes(blockHash, block, s.Confirmations(block.Header.Height))
+		if err != nil {
+			return res, err
+		}
+		res.Blocks = append(res.Blocks, blockRes)
+	}
+
+	return res, nil
+}
+
+// listNodeBlocks pages through the node's blocks.
+func listNodeBlocks(nodeURL string, from, to uint64) (node.BlocksRes, error) {
+	res := node.BlocksRes{Blocks: make([]node.BlockRes, 0)}
+
+	for from <= to {
+		query := url.Values{}
+		query.Set("from", strconv.FormatUint(from, 10))
+		if to != math.MaxUint64 {
+			query.Set("to", strconv.FormatUint(to, 10))
+		}
+
+		var page node.BlocksRes
+		if err := getNodeRes(nodeURL, "/blocks?"+query.Encode(), &page); err != nil {
+			return res, err
+		}
+		if len(page.Blocks) == 0 {
+			break
+		}
+
+		res.Blocks = append(res.Blocks, page.Blocks...)
+		from = page.Blocks[len(page.Blocks)-1].Block.Header.Height + 1
+		if from == 0 {
+			break
+		}
+	}
+
+	return res, nil
+}
+
+func getNodeRes(nodeURL string, path string, res any) error {
+	httpRes, err := http.Get(strings.TrimSuffix(nodeURL, "/") + path)
+	if err != nil {
+		return err
+	}
+	defer httpRes.Body.Close()
+
+	return readNodeRes(httpRes, res)
+}
+
+func printBlock(res node.BlockRes) {
+	header := res.Block.Header
+
+	fmt.Printf("Block:         %s\n", res.Hash.Hex())
+	fmt.Printf("Height:        %d\n", header.Height)
+	fmt.Printf("Parent:        %s\n", header.Parent.Hex())
+	fmt.Printf("Time:          %s\n", formatBlockTime(header.Time))
+	fmt.Printf("Miner:         %s\n", header.Miner.Hex())
+	fmt.Printf("Difficulty:    %d\n", header.Difficulty)
+	fmt.Printf("Nonce:         %d\n", header.Nonce)
+	fmt.Printf("Trx root:      %s\n", header.TrxRoot.Hex())
+	fmt.Printf("State root:    %s\n", header.StateRoot.Hex())
+	fmt.Printf("Reward:        %d (%d in fees)\n", res.Reward, res.Block.Fees())
+	fmt.Printf("Confirmations: %d\n", res.Confirmations)
+	fmt.Printf("Transactions:  %d\n", len(res.Block.TRXs))
+
+	if len(res.Block.TRXs) == 0 {
+		return
+	}
+
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 1, 1, 2, ' ', 0)
+	fmt.Fprintln(w, "HASH\tFROM\tTO\tVALUE\tFEE\tNONCE")
+	for i, trx := range res.Block.TRXs {
+		var trxHash string
+		if i < len(res.TrxHashes) {
+			trxHash = res.TrxHashes[i].Hex()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%d\n", trxHash, trx.From.Hex(), trx.To.Hex(), trx.Value, trx.Fee, trx.Nonce)
+	}
+	w.Flush()
+}
+
+func formatBlockTime(nano uint64) string {
+	return time.Unix(0, int64(nano)).UTC().Format(time.RFC3339Nano)
+}
+
+func printJSON(v any) {
+	vJSON, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Printf("%s\n", vJSON)
+}
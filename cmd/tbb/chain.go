@@ -0,0 +1,337 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/marc-watters/the-block-chain-bar/v2/database"
+	"github.com/marc-watters/the-block-chain-bar/v2/fs"
+)
+
+func chainCmd() *cobra.Command {
+	chainCmd := &cobra.Command{
+		Use:   "chain",
+		Short: "Maintains the local blockchain database",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return incorrectUsage()
+		},
+		Run: func(cmd *cobra.Command, args []string) {},
+	}
+
+	chainCmd.AddCommand(chainSnapshotCmd(), chainVerifyCmd(), chainExportCmd(), chainImportCmd(), chainRollbackCmd())
+
+	return chainCmd
+}
+
+func chainSnapshotCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "snapshot",
+		Short: "Persists a snapshot of the balances at the latest block",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := snapshotChain(cmd); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	addDefaultRequiredFlags(cmd)
+	addDBEngineFlag(cmd)
+
+	return cmd
+}
+
+func snapshotChain(cmd *cobra.Command) error {
+	s, err := openChainState(cmd)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	snapshot, err := s.Snapshot()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Snapshot created at height %d (%s) with %d balances\n",
+		snapshot.Height,
+		snapshot.Hash.Hex(),
+		len(snapshot.Balances),
+	)
+
+	return nil
+}
+
+func chainVerifyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Re-validates every stored block and reports the first invalid one",
+		Long: `Re-validates every stored block and reports the first invalid one.
+
+Every block is replayed from the genesis: its stored hash, height, parent,
+difficulty, proof of work, timestamps, transaction signatures, nonces and
+balances and its state root are checked, as are the balance snapshots.
+Blocks of a pruned datadir are replayed from its oldest usable snapshot.
+Exits with status 1 when a block is invalid.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			engine, _ := cmd.Flags().GetString(flagDBEngine)
+			asJSON, _ := cmd.Flags().GetBool(flagJSON)
+
+			report, err := database.VerifyChain(getDataDirFromCmd(cmd), database.WithEngine(engine))
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			if asJSON {
+				reportJSON, err := json.MarshalIndent(report, "", "  ")
+				if err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					os.Exit(1)
+				}
+				fmt.Println(string(reportJSON))
+			} else {
+				if report.FromSnapshot {
+					fmt.Printf("Blocks below height %d are pruned, replaying from the snapshot before it\n", report.FirstHeight)
+				}
+				fmt.Printf("Verified %d blocks from height %d\n", report.Verified, report.FirstHeight)
+				if report.Failure != nil {
+					fmt.Printf("Block %d (%s) is invalid: %s\n", report.Failure.Height, report.Failure.Hash.Hex(), report.Failure.Reason)
+				} else {
+					fmt.Printf("Chain is valid, latest block %s\n", report.LatestHash.Hex())
+				}
+			}
+
+			if !report.Valid {
+				os.Exit(1)
+			}
+		},
+	}
+
+	addDefaultRequiredFlags(cmd)
+	addDBEngineFlag(cmd)
+	cmd.Flags().Bool(flagJSON, false, "print the report as JSON")
+
+	return cmd
+}
+
+func chainExportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export <archive>",
+		Short: "Writes the genesis and a range of blocks to an archive",
+		Long: `Writes the genesis and a range of blocks to an archive.
+
+The archive is a gzipped tar holding a manifest, the genesis file and the
+blocks from --from up to and including --to, the latest block by default.
+The manifest records the height range and the checksum of every file.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := exportChain(cmd, fs.ExpandPath(args[0])); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	addDefaultRequiredFlags(cmd)
+	addDBEngineFlag(cmd)
+	cmd.Flags().Uint64(flagFrom, 0, "height of the first exported block")
+	cmd.Flags().Uint64(flagTo, 0, "height of the last exported block (defaults to the latest block)")
+
+	return cmd
+}
+
+func exportChain(cmd *cobra.Command, out string) error {
+	if fs.FileExist(out) {
+		return fmt.Errorf("'%s' already exists", out)
+	}
+
+	from, _ := cmd.Flags().GetUint64(flagFrom)
+	to := uint64(math.MaxUint64)
+	if cmd.Flags().Changed(flagTo) {
+		to, _ = cmd.Flags().GetUint64(flagTo)
+	}
+
+	s, err := openChainState(cmd)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	f, err := fs.AppFS.OpenFile(out, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+
+	manifest, err := s.ExportChain(f, from, to)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		fs.AppFS.Remove(out)
+		return err
+	}
+
+	fmt.Printf("Exported %d blocks of chain '%s', heights %d to %d, to %s\n",
+		manifest.Blocks, manifest.ChainID, manifest.FromHeight, manifest.ToHeight, out)
+
+	return nil
+}
+
+func chainImportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "import <archive>",
+		Short: "Validates and adds the blocks of an archive to the datadir",
+		Long: `Validates and adds the blocks of an archive to the datadir.
+
+A new datadir is initialized with the archived genesis, an existing one must
+hold the same genesis and the blocks preceding the archived ones. Blocks
+already stored are skipped, the others are validated as when syncing and
+must extend the latest block. A datadir initialized by a failed import is
+removed again.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := importChain(cmd, fs.ExpandPath(args[0])); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	addDefaultRequiredFlags(cmd)
+	addDBEngineFlag(cmd)
+
+	return cmd
+}
+
+func importChain(cmd *cobra.Command, archive string) error {
+	f, err := fs.AppFS.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	engine, _ := cmd.Flags().GetString(flagDBEngine)
+
+	progress := func(done, total uint64) {
+		fmt.Printf("Imported %d/%d blocks\n", done, total)
+	}
+
+	manifest, added, err := database.ImportChain(getDataDirFromCmd(cmd), f, progress, database.WithEngine(engine))
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Added %d blocks of chain '%s', %d were already stored\n",
+		added, manifest.ChainID, manifest.Blocks-added)
+
+	return nil
+}
+
+func chainRollbackCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rollback",
+		Short: "Drops the blocks above a height",
+		Long: `Drops the blocks above a height, leaving the block at --to-height as the
+latest one, and rebuilds the balances and indexes. Stop the node first.
+
+The transactions of the dropped blocks are written, oldest first, to a JSON
+file before any block is dropped. Re-submit them to a node with
+'tbb trx submit <file>'.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := rollbackChain(cmd); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	addDefaultRequiredFlags(cmd)
+	addDBEngineFlag(cmd)
+	cmd.Flags().Uint64(flagToHeight, 0, "height of the block to keep as the latest one")
+	if err := cmd.MarkFlagRequired(flagToHeight); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	cmd.Flags().String(flagRemovedTRXs, "", "file the dropped transactions are written to (defaults to removed_trxs_<height>.json in the datadir)")
+
+	return cmd
+}
+
+func rollbackChain(cmd *cobra.Command) error {
+	dataDir := getDataDirFromCmd(cmd)
+	height, _ := cmd.Flags().GetUint64(flagToHeight)
+
+	removedPath, _ := cmd.Flags().GetString(flagRemovedTRXs)
+	if removedPath == "" {
+		removedPath = filepath.Join(dataDir, fmt.Sprintf("removed_trxs_%d.json", height))
+	}
+	removedPath = fs.ExpandPath(removedPath)
+	if fs.FileExist(removedPath) {
+		return fmt.Errorf("'%s' already exists", removedPath)
+	}
+
+	s, err := openChainState(cmd)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	if height >= s.NextBlockHeight() {
+		return fmt.Errorf("no block at height %d, the latest block is at height %d", height, s.LatestBlock().Header.Height)
+	}
+	lowest, err := s.FirstRollbackHeight()
+	if err != nil {
+		return err
+	}
+	if height < lowest {
+		return fmt.Errorf("blocks were pruned, the chain can't be rolled back below height %d", lowest)
+	}
+
+	removed, err := s.GetBlocks(height+1, s.LatestBlock().Header.Height)
+	if err != nil {
+		return err
+	}
+	trxs := make([]database.SignedTrx, 0)
+	for _, b := range removed {
+		trxs = append(trxs, b.TRXs...)
+	}
+
+	trxsJSON, err := json.MarshalIndent(trxs, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := fs.AppFS.WriteFile(removedPath, trxsJSON, 0o644); err != nil {
+		return err
+	}
+
+	dropped, err := s.Rollback(height)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Dropped %d blocks, latest block %d (%s)\n", dropped, height, s.LatestBlockHash().Hex())
+	fmt.Printf("Wrote the %d transactions of the dropped blocks to %s\n", len(trxs), removedPath)
+
+	return nil
+}
+
+// openChainState loads the state of an initialized datadir.
+func openChainState(cmd *cobra.Command) (*database.State, error) {
+	dataDir := getDataDirFromCmd(cmd)
+	if !fs.FileExist(fs.GetGenesisJSONFilePath(dataDir)) {
+		return nil, fmt.Errorf("'%s' isn't an initialized datadir", dataDir)
+	}
+
+	engine, _ := cmd.Flags().GetString(flagDBEngine)
+
+	return database.NewStateFromDisk(dataDir, database.WithEngine(engine))
+}
+
+func addDBEngineFlag(cmd *cobra.Command) {
+	cmd.Flags().String(flagDBEngine, "", fmt.Sprintf("storage engine: '%s' or '%s' (detected from the datadir when empty)", database.EngineFile, database.EngineLevelDB))
+}
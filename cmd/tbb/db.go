@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/spf13/cobra"
+
+	"github.com/marc-watters/the-block-chain-bar/v2/database"
+	"github.com/marc-watters/the-block-chain-bar/v2/fs"
+	"github.com/marc-watters/the-block-chain-bar/v2/wallet"
+)
+
+func dbCmd() *cobra.Command {
+	dbCmd := &cobra.Command{
+		Use:   "db",
+		Short: "Manages the on-disk database format",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return incorrectUsage()
+		},
+		Run: func(cmd *cobra.Command, args []string) {},
+	}
+
+	dbCmd.AddCommand(dbMigrateCmd())
+
+	return dbCmd
+}
+
+func dbMigrateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Converts a legacy database to the current format",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return incorrectUsage()
+		},
+		Run: func(cmd *cobra.Command, args []string) {},
+	}
+
+	cmd.AddCommand(dbMigrateBlocksCmd())
+	cmd.AddCommand(dbMigrateV1Cmd())
+
+	return cmd
+}
+
+func dbMigrateBlocksCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "blocks",
+		Short: "Converts a block.db of JSON records to the binary format",
+		Long: `Converts a block.db of JSON records to the binary format.
+
+Block hashes are computed over the binary encoding, so the proof of work of
+every block is redone, which takes a while at high difficulties. The JSON
+records are kept in block.db.json.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			dataDir := getDataDirFromCmd(cmd)
+
+			if database.IsLegacyDataDir(dataDir) {
+				fmt.Fprintf(os.Stderr, "'%s' holds a legacy v1 database, run 'tbb db migrate v1' instead\n", dataDir)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Migrating %s...\n", fs.GetBlocksDBFilePath(dataDir))
+
+			migrated, err := database.MigrateBlocksDB(dataDir)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Migrated %d blocks\n", migrated)
+		},
+	}
+
+	addDefaultRequiredFlags(cmd)
+
+	return cmd
+}
+
+func dbMigrateV1Cmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "v1",
+		Short: "Converts a legacy v1 database naming its accounts",
+		Long: `Converts a legacy v1 database, naming its accounts instead of using
+addresses, to the current format.
+
+--accounts is a JSON file mapping each account name to an address. By default
+the v1 history is collapsed into the balances of a new genesis. With --replay
+every v1 transfer is signed again with the keystore and every v1 block mined
+again by --miner, the v1 rewards being credited in the genesis. The v1
+database is kept in database.v1. Use --dry-run to only report the result.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			dataDir := getDataDirFromCmd(cmd)
+
+			if !database.IsLegacyDataDir(dataDir) {
+				fmt.Fprintf(os.Stderr, "'%s' doesn't hold a legacy v1 database\n", dataDir)
+				os.Exit(1)
+			}
+
+			migrateLegacyDataDir(cmd, dataDir)
+		},
+	}
+
+	addDefaultRequiredFlags(cmd)
+	cmd.Flags().String(flagAccounts, "", "JSON file mapping the v1 account names to addresses")
+	cmd.Flags().Bool(flagReplay, false, "sign and mine the v1 blocks again instead of collapsing them into the genesis")
+	cmd.Flags().String(flagMiner, "", "v1 account name or address mining the replayed blocks")
+	cmd.Flags().String(flagKeystore, "", "keystore signing the replayed transfers (defaults to the datadir keystore)")
+	cmd.Flags().Uint64(flagDifficulty, database.DefaultDifficulty, "proof-of-work difficulty of the converted chain")
+	cmd.Flags().Bool(flagDryRun, false, "report the conversion without writing anything")
+
+	return cmd
+}
+
+func migrateLegacyDataDir(cmd *cobra.Command, dataDir string) {
+	flags := cmd.Flags()
+
+	accountsPath, _ := flags.GetString(flagAccounts)
+	if accountsPath == "" {
+		fmt.Fprintf(os.Stderr, "--%s is required\n", flagAccounts)
+		os.Exit(1)
+	}
+	accountsJSON, err := fs.AppFS.ReadFile(fs.ExpandPath(accountsPath))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	m := database.LegacyMigration{Accounts: make(map[string]common.Address)}
+	if err := json.Unmarshal(accountsJSON, &m.Accounts); err != nil {
+		fmt.Fprintf(os.Stderr, "unable to read account mapping '%s': %v\n", accountsPath, err)
+		os.Exit(1)
+	}
+
+	m.Params.Difficulty, _ = flags.GetUint64(flagDifficulty)
+	m.Params.RetargetInterval = database.DefaultRetargetInterval
+	m.DryRun, _ = flags.GetBool(flagDryRun)
+
+	if replay, _ := flags.GetBool(flagReplay); replay {
+		miner, _ := flags.GetString(flagMiner)
+		if account, ok := m.Accounts[miner]; ok {
+			m.Miner = account
+		} else if common.IsHexAddress(miner) {
+			m.Miner = database.NewAccount(miner)
+		} else {
+			fmt.Fprintf(os.Stderr, "--%s must be a mapped v1 account or an address, got '%s'\n", flagMiner, miner)
+			os.Exit(1)
+		}
+
+		keystoreDir, _ := flags.GetString(flagKeystore)
+		if keystoreDir == "" {
+			keystoreDir = wallet.GetKeystoreDirPath(dataDir)
+		}
+		m.Sign = keystoreSigner(fs.ExpandPath(keystoreDir))
+	}
+
+	report, err := database.MigrateLegacyDataDir(dataDir, m)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Legacy v1 database: %d blocks, %d transfers, %d rewards, %d empty transfers skipped\n",
+		report.Blocks, report.Transfers, report.Rewards, report.Skipped)
+	if report.Replayed {
+		fmt.Printf("Blocks are replayed, mined by %s\n", m.Miner.Hex())
+	} else {
+		fmt.Println("History is collapsed into the genesis balances")
+	}
+
+	genesisJSON, err := report.Genesis.Encode()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Printf("Genesis:\n%s\n", genesisJSON)
+
+	fmt.Println("Balances after migration:")
+	accounts := slices.SortedFunc(maps.Keys(report.Balances), func(a, b common.Address) int {
+		return bytes.Compare(a[:], b[:])
+	})
+	for _, account := range accounts {
+		fmt.Printf("\t%s: %d\n", account.Hex(), report.Balances[account])
+	}
+
+	if m.DryRun {
+		fmt.Println("Dry run, nothing was written")
+		return
+	}
+	fmt.Printf("Migrated, the v1 database is kept in %s\n", report.LegacyDir)
+}
+
+// keystoreSigner asks each keystore account's password once.
+func keystoreSigner(keystoreDir string) func(database.Trx, string) (database.SignedTrx, error) {
+	keys := make(map[common.Address]*ecdsa.PrivateKey)
+
+	return func(trx database.Trx, chainID string) (database.SignedTrx, error) {
+		privKey, ok := keys[trx.From]
+		if !ok {
+			password := getPassPhrase(fmt.Sprintf("Please enter the password of %s:", trx.From.Hex()), false)
+
+			var err error
+			if privKey, err = wallet.DecryptKeystoreAccount(trx.From, password, keystoreDir); err != nil {
+				return database.SignedTrx{}, err
+			}
+			keys[trx.From] = privKey
+		}
+
+		return wallet.SignTrx(trx, chainID, privKey)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/spf13/cobra"
+
+	"github.com/marc-watters/the-block-chain-bar/v2/database"
+	"github.com/marc-watters/the-block-chain-bar/v2/fs"
+)
+
+func genesisCmd() *cobra.Command {
+	genesisCmd := &cobra.Command{
+		Use:   "genesis",
+		Short: "Creates the genesis of a new chain",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return incorrectUsage()
+		},
+		Run: func(cmd *cobra.Command, args []string) {},
+	}
+
+	genesisCmd.AddCommand(genesisInitCmd())
+
+	return genesisCmd
+}
+
+func genesisInitCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "init",
+		Short: "Writes a genesis file built from flags or a template",
+		Long: `Writes a genesis file built from flags or a template.
+
+Flags override the fields of the template. Without a template the genesis
+starts now with the default consensus parameters and no balances. Each
+--alloc sets the initial balance of an account as <address>=<amount>.
+
+Launch a node on the new chain with 'tbb run --genesis <file>'.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			g, err := genesisFromFlags(cmd)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			if err := g.Validate(); err != nil {
+				fmt.Fprintf(os.Stderr, "invalid genesis: %v\n", err)
+				os.Exit(1)
+			}
+
+			content, err := g.Encode()
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			out, _ := cmd.Flags().GetString(flagOut)
+			out = fs.ExpandPath(out)
+			force, _ := cmd.Flags().GetBool(flagForce)
+			if fs.FileExist(out) && !force {
+				fmt.Fprintf(os.Stderr, "'%s' already exists, use --%s to overwrite it\n", out, flagForce)
+				os.Exit(1)
+			}
+
+			if err := fs.AppFS.WriteFile(out, content, 0o644); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Genesis of chain '%s' written to %s\n", g.ChainID, out)
+		},
+	}
+
+	cmd.Flags().String(flagOut, fs.GenFile, "path the genesis file is written to")
+	cmd.Flags().Bool(flagForce, false, "overwrite an existing genesis file")
+	cmd.Flags().String(flagTemplate, "", "genesis file the new genesis starts from")
+	cmd.Flags().String(flagChainID, "", "identifier of the chain transactions are signed for")
+	cmd.Flags().String(flagGenesisTime, "", "RFC 3339 time the chain starts at (defaults to now)")
+	cmd.Flags().Uint64(flagDifficulty, database.DefaultDifficulty, "initial proof-of-work difficulty")
+	cmd.Flags().Uint64(flagBlockTime, database.DefaultBlockTime, "block interval, in seconds, the difficulty is retargeted toward")
+	cmd.Flags().Uint64(flagRetargetInterval, database.DefaultRetargetInterval, "retarget the difficulty every N blocks (0 keeps it fixed)")
+	cmd.Flags().StringArray(flagAlloc, nil, "initial balance as <address>=<amount> (repeatable)")
+
+	return cmd
+}
+
+// genesisFromFlags builds the genesis from the template and the flags.
+func genesisFromFlags(cmd *cobra.Command) (database.Genesis, error) {
+	flags := cmd.Flags()
+
+	g := database.Genesis{
+		Time: time.Now().UTC().Truncate(time.Second),
+		ChainParams: database.ChainParams{
+			Difficulty:       database.DefaultDifficulty,
+			BlockTime:        database.DefaultBlockTime,
+			RetargetInterval: database.DefaultRetargetInterval,
+		},
+		Balances: make(map[common.Address]uint64),
+	}
+
+	if template, _ := flags.GetString(flagTemplate); template != "" {
+		var err error
+		if g, err = database.LoadGenesis(fs.ExpandPath(template)); err != nil {
+			return database.Genesis{}, err
+		}
+		if g.Balances == nil {
+			g.Balances = make(map[common.Address]uint64)
+		}
+	}
+
+	if flags.Changed(flagChainID) {
+		g.ChainID, _ = flags.GetString(flagChainID)
+	}
+	if flags.Changed(flagGenesisTime) {
+		value, _ := flags.GetString(flagGenesisTime)
+		genesisTime, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return database.Genesis{}, fmt.Errorf("invalid --%s: %v", flagGenesisTime, err)
+		}
+		g.Time = genesisTime
+	}
+	if flags.Changed(flagDifficulty) {
+		g.Difficulty, _ = flags.GetUint64(flagDifficulty)
+	}
+	if flags.Changed(flagBlockTime) {
+		g.BlockTime, _ = flags.GetUint64(flagBlockTime)
+	}
+	if flags.Changed(flagRetargetInterval) {
+		g.RetargetInterval, _ = flags.GetUint64(flagRetargetInterval)
+	}
+
+	allocs, _ := flags.GetStringArray(flagAlloc)
+	for _, alloc := range allocs {
+		account, amount, ok := strings.Cut(alloc, "=")
+		if !ok || !common.IsHexAddress(account) {
+			return database.Genesis{}, fmt.Errorf("invalid --%s '%s', expected <address>=<amount>", flagAlloc, alloc)
+		}
+
+		balance, err := strconv.ParseUint(amount, 10, 64)
+		if err != nil {
+			return database.Genesis{}, fmt.Errorf("invalid --%s amount '%s': %v", flagAlloc, amount, err)
+		}
+
+		g.Balances[database.NewAccount(account)] = balance
+	}
+
+	return g, nil
+}
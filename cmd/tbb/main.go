@@ -10,13 +10,43 @@ import (
 )
 
 const (
-	flagDataDir       = "datadir"
-	flagMiner         = "miner"
-	flagIP            = "ip"
-	flagPort          = "port"
-	flagBootstrapAcc  = "bootstrap-account"
-	flagBootstrapIP   = "bootstrap-ip"
-	flagBootstrapPort = "bootstrap-port"
+	flagDataDir          = "datadir"
+	flagMiner            = "miner"
+	flagIP               = "ip"
+	flagPort             = "port"
+	flagBootstrapAcc     = "bootstrap-account"
+	flagBootstrapIP      = "bootstrap-ip"
+	flagBootstrapPort    = "bootstrap-port"
+	flagDBEngine         = "db-engine"
+	flagSnapshotInterval = "snapshot-interval"
+	flagFsync            = "fsync"
+	flagSegmentSize      = "segment-size"
+	flagPrune            = "prune"
+	flagMinFee           = "min-fee"
+	flagOffset           = "offset"
+	flagLimit            = "limit"
+	flagHeight           = "height"
+	flagAccount          = "account"
+	flagGenesis          = "genesis"
+	flagOut              = "out"
+	flagForce            = "force"
+	flagTemplate         = "template"
+	flagChainID          = "chain-id"
+	flagGenesisTime      = "genesis-time"
+	flagDifficulty       = "difficulty"
+	flagBlockTime        = "block-time"
+	flagRetargetInterval = "retarget-interval"
+	flagAlloc            = "alloc"
+	flagAccounts         = "accounts"
+	flagReplay           = "replay"
+	flagKeystore         = "keystore"
+	flagDryRun           = "dry-run"
+	flagJSON             = "json"
+	flagFrom             = "from"
+	flagTo               = "to"
+	flagToHeight         = "to-height"
+	flagRemovedTRXs      = "removed-trxs"
+	flagNode             = "node"
 )
 
 func main() {
@@ -30,8 +60,14 @@ func main() {
 	}
 
 	tbbCmd.AddCommand(
+		accountCmd(),
 		balancesCmd(),
+		blockCmd(),
+		chainCmd(),
+		dbCmd(),
+		genesisCmd(),
 		runCmd(),
+		trxCmd(),
 		walletCmd(),
 		versionCmd(),
 	)
@@ -8,6 +8,7 @@ import (
 	"github.com/spf13/cobra"
 
 	db "github.com/marc-watters/the-block-chain-bar/v2/database"
+	"github.com/marc-watters/the-block-chain-bar/v2/fs"
 	node "github.com/marc-watters/the-block-chain-bar/v2/node"
 )
 
@@ -51,7 +52,63 @@ func runCmd() *cobra.Command {
 				fmt.Fprintln(os.Stderr, err)
 				os.Exit(1)
 			}
-			s, err := db.NewStateFromDisk(getDataDirFromCmd(cmd))
+
+			engine, err := cmd.Flags().GetString(flagDBEngine)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			syncPolicy, err := cmd.Flags().GetString(flagFsync)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			snapshotInterval, err := cmd.Flags().GetUint64(flagSnapshotInterval)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			segmentSize, err := cmd.Flags().GetUint64(flagSegmentSize)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			pruneKeep, err := cmd.Flags().GetUint64(flagPrune)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			minTrxFee, err := cmd.Flags().GetUint64(flagMinFee)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			if genesisPath, _ := cmd.Flags().GetString(flagGenesis); genesisPath != "" {
+				g, err := db.LoadGenesis(fs.ExpandPath(genesisPath))
+				if err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					os.Exit(1)
+				}
+				if err := db.InitDataDir(getDataDirFromCmd(cmd), g); err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					os.Exit(1)
+				}
+			}
+
+			s, err := db.NewStateFromDisk(
+				getDataDirFromCmd(cmd),
+				db.WithEngine(engine),
+				db.WithSyncPolicy(syncPolicy),
+				db.WithSnapshotInterval(snapshotInterval),
+				db.WithSegmentSize(int64(segmentSize)),
+				db.WithPruning(pruneKeep),
+			)
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "error getting new state from disk: %v", err)
 				os.Exit(1)
@@ -70,7 +127,8 @@ func runCmd() *cobra.Command {
 				ip,
 				port,
 				db.NewAccount(miner),
-				bootstrap)
+				bootstrap,
+				minTrxFee)
 
 			fmt.Println("Launching TBB node and its HTTP API...")
 			if err := n.Run(context.Background()); err != nil {
@@ -87,6 +145,13 @@ func runCmd() *cobra.Command {
 	cmd.Flags().String(flagBootstrapIP, node.DefaultBootstrapIP, "default bootstrap server to interconnect peers")
 	cmd.Flags().Uint64(flagBootstrapPort, node.DefaultBootstrapPort, "default bootstrap server port to interconnect peers")
 	cmd.Flags().String(flagBootstrapAcc, node.DefaultBootstrapAcc, "default bootstrap account to interconnect peers")
+	cmd.Flags().String(flagGenesis, "", "genesis file a new datadir is initialized with (the built-in genesis when empty)")
+	cmd.Flags().String(flagDBEngine, "", fmt.Sprintf("storage engine: '%s' or '%s' (detected from the datadir when empty)", db.EngineFile, db.EngineLevelDB))
+	cmd.Flags().String(flagFsync, db.SyncAlways, fmt.Sprintf("when to fsync appended blocks: '%s' or '%s'", db.SyncAlways, db.SyncNever))
+	cmd.Flags().Uint64(flagSnapshotInterval, db.DefaultSnapshotInterval, "snapshot the balances every N blocks (0 disables snapshots)")
+	cmd.Flags().Uint64(flagSegmentSize, db.DefaultSegmentSize, "bytes of blocks collected before sealing them into a compressed segment (file engine, new datadirs only)")
+	cmd.Flags().Uint64(flagPrune, 0, fmt.Sprintf("keep only the latest N blocks, at least %d, and a state snapshot (0 keeps every block)", db.MinPruneKeep))
+	cmd.Flags().Uint64(flagMinFee, node.DefaultMinTrxFee, "lowest transaction fee accepted into the pending transactions pool")
 
 	return cmd
 }
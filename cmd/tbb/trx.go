@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/marc-watters/the-block-chain-bar/v2/database"
+	"github.com/marc-watters/the-block-chain-bar/v2/fs"
+	"github.com/marc-watters/the-block-chain-bar/v2/node"
+)
+
+func trxCmd() *cobra.Command {
+	trxCmd := &cobra.Command{
+		Use:   "trx",
+		Short: "Looks up mined transactions and submits signed ones",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return incorrectUsage()
+		},
+		Run: func(cmd *cobra.Command, args []string) {},
+	}
+
+	trxCmd.AddCommand(trxShowCmd(), trxSubmitCmd())
+
+	return trxCmd
+}
+
+func trxShowCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "show <trx-hash>",
+		Short: "Shows a mined transaction with its block and confirmations",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			var trxHash database.Hash
+			if err := trxHash.UnmarshalText([]byte(args[0])); err != nil {
+				fmt.Fprintf(os.Stderr, "invalid transaction hash '%s': %v\n", args[0], err)
+				os.Exit(1)
+			}
+
+			s, err := database.NewStateFromDisk(getDataDirFromCmd(cmd))
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			defer s.Close()
+
+			trx, location, err := s.GetTrx(trxHash)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			trxJSON, err := json.MarshalIndent(trx, "", "  ")
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Transaction:   %s\n", trxHash.Hex())
+			fmt.Printf("Block:         %s\n", location.BlockHash.Hex())
+			fmt.Printf("Height:        %d\n", location.BlockHeight)
+			fmt.Printf("Position:      %d\n", location.Position)
+			fmt.Printf("Confirmations: %d\n", s.Confirmations(location.BlockHeight))
+			fmt.Printf("%s\n", trxJSON)
+		},
+	}
+
+	addDefaultRequiredFlags(cmd)
+
+	return cmd
+}
+
+func trxSubmitCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "submit <file>",
+		Short: "Submits the signed transactions of a JSON file to a node",
+		Long: `Submits the signed transactions of a JSON file, such as the one written by
+'tbb chain rollback', to the pending transactions of a node. Transactions
+the node already mined or no longer accepts are reported as rejected.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			trxsJSON, err := fs.AppFS.ReadFile(fs.ExpandPath(args[0]))
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			var trxs []database.SignedTrx
+			if err := json.Unmarshal(trxsJSON, &trxs); err != nil {
+				fmt.Fprintf(os.Stderr, "unable to read transactions from '%s': %v\n", args[0], err)
+				os.Exit(1)
+			}
+
+			nodeURL, _ := cmd.Flags().GetString(flagNode)
+
+			var accepted, rejected int
+			for _, batch := range submitBatches(trxs) {
+				res, err := submitTRXs(nodeURL, batch)
+				if err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					os.Exit(1)
+				}
+
+				for _, trxHash := range res.Accepted {
+					fmt.Printf("Accepted %s\n", trxHash.Hex())
+				}
+				for _, rejection := range res.Rejected {
+					fmt.Printf("Rejected %s: %s\n", rejection.Hash.Hex(), rejection.Error)
+				}
+				accepted += len(res.Accepted)
+				rejected += len(res.Rejected)
+			}
+
+			fmt.Printf("%d transactions accepted, %d rejected\n", accepted, rejected)
+		},
+	}
+
+	cmd.Flags().String(flagNode, fmt.Sprintf("http://%s:%d", node.DefaultIP, node.DefaultHTTPort), "URL of the node the transactions are submitted to")
+
+	return cmd
+}
+
+// submitBatches splits the transactions into requests no larger than a block.
+func submitBatches(trxs []database.SignedTrx) [][]database.SignedTrx {
+	batches := make([][]database.SignedTrx, 0)
+
+	var batch []database.SignedTrx
+	size := 0
+	for _, trx := range trxs {
+		trxJSON, err := json.Marshal(trx)
+		if err != nil {
+			continue
+		}
+
+		if len(batch) > 0 && size+len(trxJSON)+1 >= database.MaxBlockSize {
+			batches = append(batches, batch)
+			batch, size = nil, 0
+		}
+		batch = append(batch, trx)
+		size += len(trxJSON) + 1
+	}
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+
+	return batches
+}
+
+func submitTRXs(nodeURL string, trxs []database.SignedTrx) (node.TrxSubmitRes, error) {
+	var res node.TrxSubmitRes
+
+	reqJSON, err := json.Marshal(trxs)
+	if err != nil {
+		return res, err
+	}
+
+	httpRes, err := http.Post(strings.TrimSuffix(nodeURL, "/")+"/trx/submit", "application/json", bytes.NewReader(reqJSON))
+	if err != nil {
+		return res, err
+	}
+	defer httpRes.Body.Close()
+
+	err = readNodeRes(httpRes, &res)
+	return res, err
+}
+
+// readNodeRes decodes a node response into res.
+func readNodeRes(httpRes *http.Response, res any) error {
+	resJSON, err := io.ReadAll(httpRes.Body)
+	if err != nil {
+		return err
+	}
+
+	if httpRes.StatusCode != http.StatusOK {
+		var errRes node.ErrRes
+		if err := json.Unmarshal(resJSON, &errRes); err != nil || errRes.Error == "" {
+			return fmt.Errorf("node responded with status %d: %s", httpRes.StatusCode, resJSON)
+		}
+		return fmt.Errorf("node responded with status %d: %s", httpRes.StatusCode, errRes.Error)
+	}
+
+	if err := json.Unmarshal(resJSON, res); err != nil {
+		return fmt.Errorf("unable to read the node response: %v", err)
+	}
+
+	return nil
+}
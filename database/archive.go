@@ -0,0 +1,415 @@
+package database
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/ethereum/go-ethereum/rlp"
+
+	"github.com/marc-watters/the-block-chain-bar/v2/fs"
+)
+
+const (
+	archiveFormat   = "tbb-chain-archive"
+	archiveVersion  = 1
+	archiveEncoding = "rlp"
+
+	archiveManifestFile = "manifest.json"
+	archiveGenesisFile  = "genesis.json"
+	archiveBlocksFile   = "blocks.rlp"
+
+	// importBatchSize is how many blocks are imported per progress report.
+	importBatchSize = 100
+
+	// maxArchiveFileSize caps the archived files read in memory.
+	maxArchiveFileSize = 16 << 20
+)
+
+type (
+	// ArchiveManifest describes a gzipped tar of the genesis and the blocks
+	// from FromHeight to ToHeight, with the size and SHA-256 of each file.
+	ArchiveManifest struct {
+		Format     string        `json:"format"`
+		Version    int           `json:"version"`
+		ChainID    string        `json:"chain_id"`
+		FromHeight uint64        `json:"from_height"`
+		ToHeight   uint64        `json:"to_height"`
+		Blocks     uint64        `json:"blocks"`
+		Encoding   string        `json:"block_encoding"`
+		Files      []archiveFile `json:"files"`
+	}
+
+	archiveFile struct {
+		Name     string `json:"name"`
+		Size     int64  `json:"size"`
+		Checksum Hash   `json:"checksum"`
+	}
+)
+
+// ExportChain archives the genesis and the blocks from 'from' to 'to'.
+func (s *State) ExportChain(w io.Writer, from, to uint64) (ArchiveManifest, error) {
+	if s.store.Len() == 0 {
+		return ArchiveManifest{}, fmt.Errorf("no blocks to export")
+	}
+	to = min(to, s.store.Len()-1)
+	if from > to {
+		return ArchiveManifest{}, fmt.Errorf("no blocks from height %d to %d", from, to)
+	}
+
+	genesisJSON, err := fs.AppFS.ReadFile(fs.GetGenesisJSONFilePath(s.dataDir))
+	if err != nil {
+		return ArchiveManifest{}, err
+	}
+
+	var records bytes.Buffer
+	for height := from; height <= to; height++ {
+		blockFS, err := s.store.BlockByHeight(height)
+		if err != nil {
+			return ArchiveManifest{}, err
+		}
+		record, err := blockFS.Encode()
+		if err != nil {
+			return ArchiveManifest{}, err
+		}
+		records.Write(record)
+	}
+
+	manifest := ArchiveManifest{
+		Format:     archiveFormat,
+		Version:    archiveVersion,
+		ChainID:    s.chainID,
+		FromHeight: from,
+		ToHeight:   to,
+		Blocks:     to - from + 1,
+		Encoding:   archiveEncoding,
+		Files: []archiveFile{
+			{archiveGenesisFile, int64(len(genesisJSON)), sha256.Sum256(genesisJSON)},
+			{archiveBlocksFile, int64(records.Len()), sha256.Sum256(records.Bytes())},
+		},
+	}
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return ArchiveManifest{}, err
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	for _, file := range []struct {
+		name    string
+		content []byte
+	}{
+		{archiveManifestFile, manifestJSON},
+		{archiveGenesisFile, genesisJSON},
+		{archiveBlocksFile, records.Bytes()},
+	} {
+		if err := tw.WriteHeader(&tar.Header{Name: file.name, Mode: 0o644, Size: int64(len(file.content))}); err != nil {
+			return ArchiveManifest{}, err
+		}
+		if _, err := tw.Write(file.content); err != nil {
+			return ArchiveManifest{}, err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return ArchiveManifest{}, err
+	}
+	if err := gz.Close(); err != nil {
+		return ArchiveManifest{}, err
+	}
+
+	return manifest, nil
+}
+
+// ImportChain adds the archived blocks to the data directory and returns
+// how many were added.
+func ImportChain(dataDir string, r io.Reader, progress func(done, total uint64), opts ...Option) (ArchiveManifest, uint64, error) {
+	dataDir = fs.ExpandPath(dataDir)
+
+	blocksFile, err := fs.AppFS.TempFile("", "tbb_import")
+	if err != nil {
+		return ArchiveManifest{}, 0, err
+	}
+	defer fs.AppFS.Remove(blocksFile.Name())
+	defer blocksFile.Close()
+
+	manifest, genesisJSON, err := readArchive(r, blocksFile)
+	if err != nil {
+		return manifest, 0, err
+	}
+	if err := readArchivedBlocks(blocksFile, manifest, func([]BlockFS) error { return nil }); err != nil {
+		return manifest, 0, err
+	}
+
+	var g Genesis
+	if err := json.Unmarshal(genesisJSON, &g); err != nil {
+		return manifest, 0, fmt.Errorf("unable to read the archived genesis: %v", err)
+	}
+	if g.ChainID != manifest.ChainID {
+		return manifest, 0, fmt.Errorf("archived genesis is of chain '%s' not '%s'", g.ChainID, manifest.ChainID)
+	}
+	if err := g.check(); err != nil {
+		return manifest, 0, fmt.Errorf("invalid archived genesis: %w", err)
+	}
+
+	var removeCreated func()
+	if genesisPath := fs.GetGenesisJSONFilePath(dataDir); fs.FileExist(genesisPath) {
+		existing, err := LoadGenesis(genesisPath)
+		if err != nil {
+			return manifest, 0, err
+		}
+		same, err := sameGenesis(existing, g)
+		if err != nil {
+			return manifest, 0, err
+		}
+		if !same {
+			return manifest, 0, fmt.Errorf("'%s' was initialized with another genesis than the archive", dataDir)
+		}
+	} else {
+		if manifest.FromHeight > 0 {
+			return manifest, 0, fmt.Errorf("archive starts at height %d, a new datadir needs the blocks from height 0", manifest.FromHeight)
+		}
+
+		removeCreated, err = initImportDataDir(dataDir, genesisJSON)
+		if err != nil {
+			return manifest, 0, err
+		}
+	}
+
+	added, err := importBlocks(dataDir, manifest, blocksFile, progress, opts...)
+	if err != nil && removeCreated != nil {
+		removeCreated()
+		return manifest, 0, err
+	}
+
+	return manifest, added, err
+}
+
+// initImportDataDir initializes a data directory and returns its cleanup.
+func initImportDataDir(dataDir string, genesisJSON []byte) (func(), error) {
+	dataDirExists, err := fs.DirExists(dataDir)
+	if err != nil {
+		return nil, err
+	}
+	databaseDirExists, err := fs.DirExists(fs.GetDatabaseDirPath(dataDir))
+	if err != nil {
+		return nil, err
+	}
+
+	removeCreated := func() {
+		switch {
+		case !dataDirExists:
+			fs.RemoveDir(dataDir)
+		case !databaseDirExists:
+			fs.RemoveDir(fs.GetDatabaseDirPath(dataDir))
+		}
+	}
+
+	if err := fs.InitDataDirIfNotExists(dataDir, genesisJSON); err != nil {
+		removeCreated()
+		return nil, err
+	}
+
+	return removeCreated, nil
+}
+
+// importBlocks adds the archived blocks not stored yet.
+func importBlocks(dataDir string, manifest ArchiveManifest, blocksFile io.ReadSeeker, progress func(done, total uint64), opts ...Option) (uint64, error) {
+	s, err := NewStateFromDisk(dataDir, opts...)
+	if err != nil {
+		return 0, err
+	}
+	defer s.Close()
+
+	if manifest.FromHeight > s.NextBlockHeight() {
+		return 0, fmt.Errorf("archive starts at height %d, blocks from height %d are missing", manifest.FromHeight, s.NextBlockHeight())
+	}
+
+	var added, done uint64
+	tip := s.LatestBlockHash()
+	err = readArchivedBlocks(blocksFile, manifest, func(blocks []BlockFS) error {
+		batch := make([]Block, 0, len(blocks))
+		for _, blockFS := range blocks {
+			if _, ok := s.store.BlockHeight(blockFS.Key); ok {
+				continue
+			}
+			// Adding a block forking off the chain could reorganize it.
+			if blockFS.Value.Header.Parent != tip {
+				return fmt.Errorf("archived block at height %d doesn't extend the latest block '%s'", blockFS.Value.Header.Height, tip.Hex())
+			}
+			batch = append(batch, blockFS.Value)
+			tip = blockFS.Key
+		}
+
+		if err := s.AddBlocks(batch); err != nil {
+			return err
+		}
+		added += uint64(len(batch))
+		done += uint64(len(blocks))
+
+		if progress != nil {
+			progress(done, manifest.Blocks)
+		}
+		return nil
+	})
+
+	return added, err
+}
+
+// readArchive checks the archive against its manifest, copying the block
+// records to blocks.
+func readArchive(r io.Reader, blocks io.Writer) (ArchiveManifest, []byte, error) {
+	var manifest ArchiveManifest
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return manifest, nil, fmt.Errorf("unable to read archive: %v", err)
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	header, err := tr.Next()
+	if err != nil {
+		return manifest, nil, fmt.Errorf("unable to read archive: %v", err)
+	}
+	if header.Name != archiveManifestFile {
+		return manifest, nil, fmt.Errorf("archive should start with %s not '%s'", archiveManifestFile, header.Name)
+	}
+	if header.Size > maxArchiveFileSize {
+		return manifest, nil, fmt.Errorf("archived %s is too large", archiveManifestFile)
+	}
+
+	manifestJSON, err := io.ReadAll(tr)
+	if err != nil {
+		return manifest, nil, fmt.Errorf("unable to read archived '%s': %v", archiveManifestFile, err)
+	}
+	if err := json.Unmarshal(manifestJSON, &manifest); err != nil {
+		return manifest, nil, fmt.Errorf("unable to read archive manifest: %v", err)
+	}
+
+	if manifest.Format != archiveFormat || manifest.Version != archiveVersion {
+		return manifest, nil, fmt.Errorf("unsupported archive format '%s' version %d", manifest.Format, manifest.Version)
+	}
+	if manifest.Encoding != archiveEncoding {
+		return manifest, nil, fmt.Errorf("unsupported block encoding '%s'", manifest.Encoding)
+	}
+	for _, name := range []string{archiveGenesisFile, archiveBlocksFile} {
+		if !slices.ContainsFunc(manifest.Files, func(f archiveFile) bool { return f.Name == name }) {
+			return manifest, nil, fmt.Errorf("archive manifest doesn't list %s", name)
+		}
+	}
+
+	var genesisJSON bytes.Buffer
+	read := make(map[string]bool)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return manifest, nil, fmt.Errorf("unable to read archive: %v", err)
+		}
+
+		i := slices.IndexFunc(manifest.Files, func(f archiveFile) bool { return f.Name == header.Name })
+		if i < 0 {
+			continue
+		}
+		file := manifest.Files[i]
+		if read[file.Name] {
+			return manifest, nil, fmt.Errorf("archive holds %s twice", file.Name)
+		}
+		if header.Size != file.Size {
+			return manifest, nil, fmt.Errorf("archived %s should hold %d bytes not %d", file.Name, file.Size, header.Size)
+		}
+
+		var w io.Writer = io.Discard
+		switch file.Name {
+		case archiveGenesisFile:
+			if file.Size > maxArchiveFileSize {
+				return manifest, nil, fmt.Errorf("archived %s is too large", file.Name)
+			}
+			w = &genesisJSON
+		case archiveBlocksFile:
+			w = blocks
+		}
+
+		checksum := sha256.New()
+		if _, err := io.Copy(io.MultiWriter(w, checksum), tr); err != nil {
+			return manifest, nil, fmt.Errorf("unable to read archived '%s': %v", file.Name, err)
+		}
+		if Hash(checksum.Sum(nil)) != file.Checksum {
+			return manifest, nil, fmt.Errorf("archived %s doesn't match its checksum", file.Name)
+		}
+		read[file.Name] = true
+	}
+
+	for _, file := range manifest.Files {
+		if !read[file.Name] {
+			return manifest, nil, fmt.Errorf("archive holds no %s", file.Name)
+		}
+	}
+
+	return manifest, genesisJSON.Bytes(), nil
+}
+
+// readArchivedBlocks checks and passes the archived blocks to fn in batches.
+func readArchivedBlocks(blocksFile io.ReadSeeker, manifest ArchiveManifest, fn func([]BlockFS) error) error {
+	if _, err := blocksFile.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	i := slices.IndexFunc(manifest.Files, func(f archiveFile) bool { return f.Name == archiveBlocksFile })
+	stream := rlp.NewStream(bufio.NewReader(blocksFile), uint64(manifest.Files[i].Size))
+
+	var count uint64
+	batch := make([]BlockFS, 0, importBatchSize)
+	for height := manifest.FromHeight; ; height++ {
+		record, err := stream.Raw()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("corrupted archived block at height %d: %v", height, err)
+		}
+
+		blockFS, err := DecodeBlockFS(record)
+		if err != nil {
+			return fmt.Errorf("corrupted archived block at height %d: %v", height, err)
+		}
+		if blockFS.Value.Header.Height != height {
+			return fmt.Errorf("archived block should be at height %d not %d", height, blockFS.Value.Header.Height)
+		}
+		hash, err := blockFS.Value.Hash()
+		if err != nil {
+			return err
+		}
+		if hash != blockFS.Key {
+			return fmt.Errorf("archived block at height %d doesn't match its hash", height)
+		}
+		count++
+
+		batch = append(batch, blockFS)
+		if len(batch) == importBatchSize {
+			if err := fn(batch); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+	}
+
+	if manifest.Blocks == 0 || count != manifest.Blocks || manifest.ToHeight != manifest.FromHeight+manifest.Blocks-1 {
+		return fmt.Errorf("archive should hold blocks %d to %d, holds %d", manifest.FromHeight, manifest.ToHeight, count)
+	}
+	if len(batch) > 0 {
+		return fn(batch)
+	}
+
+	return nil
+}
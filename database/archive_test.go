@@ -0,0 +1,290 @@
+package database
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/json"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/marc-watters/the-block-chain-bar/v2/fs"
+)
+
+func TestExportImportChain(t *testing.T) {
+	andrej := common.HexToAddress("0x3eb92807f1f91a8d4d85bc908c7f86dcddb1df57")
+
+	dataDir := setupTestDataDirWithGenesis(t, testGenesisJSON)
+	s, err := NewStateFromDisk(dataDir)
+	if err != nil {
+		t.Fatalf("error creating state: %v", err)
+	}
+	defer s.Close()
+
+	var parent Hash
+	for height := uint64(0); height < 3; height++ {
+		b := mineTestBlock(t, parent, height, 16, andrej, map[common.Address]uint64{andrej: (height + 1) * BlockReward})
+		parent = addTestBlock(t, s, b)
+	}
+
+	var archive bytes.Buffer
+	manifest, err := s.ExportChain(&archive, 0, math.MaxUint64)
+	if err != nil {
+		t.Fatalf("error exporting chain: %v", err)
+	}
+	if manifest.Blocks != 3 || manifest.ToHeight != 2 {
+		t.Errorf("expected blocks 0 to 2 to be exported, got %+v", manifest)
+	}
+
+	var partial bytes.Buffer
+	if _, err := s.ExportChain(&partial, 1, 2); err != nil {
+		t.Fatalf("error exporting chain: %v", err)
+	}
+
+	importDir := func(t *testing.T) string {
+		t.Helper()
+
+		dir, err := fs.AppFS.TempDir(os.TempDir(), "tbb_import_test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { fs.RemoveDir(dir) })
+		return dir
+	}
+
+	t.Run("new datadir", func(t *testing.T) {
+		dir := importDir(t)
+
+		var progress []uint64
+		_, added, err := ImportChain(dir, bytes.NewReader(archive.Bytes()), func(done, total uint64) {
+			progress = append(progress, done)
+		})
+		if err != nil {
+			t.Fatalf("error importing chain: %v", err)
+		}
+		if added != 3 || len(progress) == 0 || progress[len(progress)-1] != 3 {
+			t.Errorf("expected 3 added blocks with progress, got %d and %v", added, progress)
+		}
+
+		_, added, err = ImportChain(dir, bytes.NewReader(archive.Bytes()), nil)
+		if err != nil {
+			t.Fatalf("error importing chain again: %v", err)
+		}
+		if added != 0 {
+			t.Errorf("stored blocks should be skipped, %d were added", added)
+		}
+
+		imported, err := NewStateFromDisk(dir)
+		if err != nil {
+			t.Fatalf("error loading imported state: %v", err)
+		}
+		defer imported.Close()
+
+		if imported.LatestBlockHash() != parent || imported.Balances()[andrej] != 3*BlockReward {
+			t.Errorf("imported chain should end at %s with the exported balances", parent.Hex())
+		}
+	})
+
+	t.Run("missing blocks", func(t *testing.T) {
+		dir := importDir(t)
+		if _, _, err := ImportChain(dir, bytes.NewReader(partial.Bytes()), nil); err == nil {
+			t.Errorf("expected importing blocks without their predecessors to fail")
+		}
+		if exists, _ := fs.DirExists(fs.GetDatabaseDirPath(dir)); exists {
+			t.Errorf("a rejected archive shouldn't initialize the datadir")
+		}
+	})
+
+	t.Run("checksum", func(t *testing.T) {
+		tampered := rewriteTestArchive(t, archive.Bytes(), archiveBlocksFile, func(content []byte) []byte {
+			content[len(content)-1] ^= 0xff
+			return content
+		})
+		if _, _, err := ImportChain(importDir(t), bytes.NewReader(tampered), nil); err == nil {
+			t.Errorf("expected importing a tampered archive to fail")
+		}
+	})
+
+	t.Run("unknown file", func(t *testing.T) {
+		extended := rewriteTestArchive(t, archive.Bytes(), "README", func([]byte) []byte {
+			return []byte("exported chain")
+		})
+		if _, added, err := ImportChain(importDir(t), bytes.NewReader(extended), nil); err != nil || added != 3 {
+			t.Errorf("files the manifest doesn't list should be skipped, added %d: %v", added, err)
+		}
+	})
+
+	t.Run("wrong file size", func(t *testing.T) {
+		tampered := rewriteTestArchive(t, archive.Bytes(), archiveGenesisFile, func(content []byte) []byte {
+			return append(content, ' ')
+		})
+		if _, _, err := ImportChain(importDir(t), bytes.NewReader(tampered), nil); err == nil {
+			t.Errorf("expected importing a file larger than listed to fail")
+		}
+	})
+
+	t.Run("huge block count", func(t *testing.T) {
+		tampered := rewriteTestArchive(t, archive.Bytes(), archiveManifestFile, func(content []byte) []byte {
+			var m ArchiveManifest
+			if err := json.Unmarshal(content, &m); err != nil {
+				t.Fatal(err)
+			}
+			m.Blocks = 1 << 62
+			content, err := json.Marshal(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return content
+		})
+		if _, _, err := ImportChain(importDir(t), bytes.NewReader(tampered), nil); err == nil {
+			t.Errorf("expected importing an archive miscounting its blocks to fail")
+		}
+	})
+
+	t.Run("failed import removes the datadir", func(t *testing.T) {
+		// Blocks mined on another genesis don't match the allocated balances.
+		genesisJSON := []byte(`{"chain_id": "tbb-test", "difficulty": 16, "retarget_interval": 0, "balances": {"0x3eb92807f1f91a8d4d85bc908c7f86dcddb1df57": 1}}`)
+		tampered := rewriteTestArchiveGenesis(t, archive.Bytes(), genesisJSON)
+
+		dir := filepath.Join(importDir(t), "new")
+		if _, _, err := ImportChain(dir, bytes.NewReader(tampered), nil); err == nil {
+			t.Fatalf("expected importing blocks not matching the genesis to fail")
+		}
+		if exists, _ := fs.DirExists(dir); exists {
+			t.Errorf("the datadir initialized by a failed import should be removed")
+		}
+	})
+
+	t.Run("forked block", func(t *testing.T) {
+		var first bytes.Buffer
+		if _, err := s.ExportChain(&first, 0, 0); err != nil {
+			t.Fatalf("error exporting chain: %v", err)
+		}
+
+		dir := importDir(t)
+		if _, _, err := ImportChain(dir, bytes.NewReader(first.Bytes()), nil); err != nil {
+			t.Fatalf("error importing chain: %v", err)
+		}
+
+		// A block mined now forks off the exported chain.
+		local, err := NewStateFromDisk(dir)
+		if err != nil {
+			t.Fatalf("error loading imported state: %v", err)
+		}
+		genesisBlock, err := local.GetBlockByHeight(0)
+		if err != nil {
+			local.Close()
+			t.Fatal(err)
+		}
+		fork := mineTestBlock(t, genesisBlock.Key, 1, 16, andrej, map[common.Address]uint64{andrej: 2 * BlockReward})
+		forkHash := addTestBlock(t, local, fork)
+		local.Close()
+
+		if _, _, err := ImportChain(dir, bytes.NewReader(archive.Bytes()), nil); err == nil {
+			t.Errorf("expected importing blocks forking off the chain to fail")
+		}
+
+		local, err = NewStateFromDisk(dir)
+		if err != nil {
+			t.Fatalf("error loading imported state: %v", err)
+		}
+		defer local.Close()
+
+		if local.LatestBlockHash() != forkHash {
+			t.Errorf("a rejected import shouldn't reorganize the chain")
+		}
+	})
+}
+
+// rewriteTestArchiveGenesis returns the archive with its genesis replaced
+// and the manifest checksum updated to match.
+func rewriteTestArchiveGenesis(t *testing.T, archive []byte, genesisJSON []byte) []byte {
+	t.Helper()
+
+	archive = rewriteTestArchive(t, archive, archiveGenesisFile, func([]byte) []byte {
+		return genesisJSON
+	})
+
+	return rewriteTestArchive(t, archive, archiveManifestFile, func(content []byte) []byte {
+		var m ArchiveManifest
+		if err := json.Unmarshal(content, &m); err != nil {
+			t.Fatal(err)
+		}
+		for i := range m.Files {
+			if m.Files[i].Name == archiveGenesisFile {
+				m.Files[i].Size = int64(len(genesisJSON))
+				m.Files[i].Checksum = sha256.Sum256(genesisJSON)
+			}
+		}
+		content, err := json.Marshal(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return content
+	})
+}
+
+// rewriteTestArchive returns the archive with the content of one file
+// replaced by what alter returns, leaving the other files as they are. A
+// missing file is added at the end.
+func rewriteTestArchive(t *testing.T, archive []byte, name string, alter func([]byte) []byte) []byte {
+	t.Helper()
+
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+
+	var out bytes.Buffer
+	gzOut := gzip.NewWriter(&out)
+	tw := tar.NewWriter(gzOut)
+	found := false
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header.Name == name {
+			content = alter(content)
+			header.Size = int64(len(content))
+			found = true
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !found {
+		content := alter(nil)
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gzOut.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return out.Bytes()
+}
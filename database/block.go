@@ -4,10 +4,11 @@ import (
 	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
-	"encoding/json"
 	"fmt"
+	"math"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rlp"
 )
 
 const BlockReward = 100
@@ -22,11 +23,14 @@ type (
 		TRXs   []SignedTrx `json:"payload"`
 	}
 	BlockHeader struct {
-		Parent Hash           `json:"parent"`
-		Height uint64         `json:"height"`
-		Nonce  uint32         `json:"nonce"`
-		Time   uint64         `json:"time"`
-		Miner  common.Address `json:"miner"`
+		Parent     Hash           `json:"parent"`
+		Height     uint64         `json:"height"`
+		Difficulty uint64         `json:"difficulty"`
+		Nonce      uint32         `json:"nonce"`
+		Time       uint64         `json:"time"`
+		Miner      common.Address `json:"miner"`
+		TrxRoot    Hash           `json:"trx_root"`
+		StateRoot  Hash           `json:"state_root"`
 	}
 
 	Hash [32]byte
@@ -49,21 +53,115 @@ func (h Hash) IsEmpty() bool {
 	return bytes.Equal(h[:], []byte(new(Hash)[:]))
 }
 
-func (h Hash) IsValid() bool {
-	return fmt.Sprintf("%x", h[0]) == "0" &&
-		fmt.Sprintf("%x", h[1]) == "0" &&
-		fmt.Sprintf("%x", h[2]) == "0" &&
-		fmt.Sprintf("%x", h[3]) != "0"
+// NewBlock creates a block committing to the transactions and the state
+// root after them, see State.PendingStateRoot.
+func NewBlock(parent Hash, height uint64, difficulty uint64, nonce uint32, time uint64, miner common.Address, stateRoot Hash, trxs []SignedTrx) Block {
+	b := Block{BlockHeader{parent, height, difficulty, nonce, time, miner, Hash{}, stateRoot}, trxs}
+	b.Header.TrxRoot, _ = b.TrxRoot()
+	return b
 }
 
-func NewBlock(parent Hash, height uint64, nonce uint32, time uint64, miner common.Address, trxs []SignedTrx) Block {
-	return Block{BlockHeader{parent, height, nonce, time, miner}, trxs}
+// Fees sums the fees of all the block transactions.
+func (b Block) Fees() uint64 {
+	var fees uint64
+	for _, trx := range b.TRXs {
+		fees += trx.Fee
+	}
+	return fees
+}
+
+// Reward is the BlockReward plus the fees of the block.
+func (b Block) Reward() uint64 {
+	return BlockReward + b.Fees()
+}
+
+// Work is the expected number of hashes needed to meet the difficulty.
+func (b Block) Work() uint64 {
+	return b.Header.Difficulty
 }
 
+// addWork adds a block's work to chain work, saturating on overflow.
+func addWork(chainWork, work uint64) uint64 {
+	if chainWork > math.MaxUint64-work {
+		return math.MaxUint64
+	}
+	return chainWork + work
+}
+
+// Hash identifies the block by its header alone.
 func (b Block) Hash() (Hash, error) {
-	blockJSON, err := json.Marshal(b)
+	return b.Header.Hash()
+}
+
+// Hash is computed over the canonical binary encoding of the header.
+func (h BlockHeader) Hash() (Hash, error) {
+	headerRLP, err := rlp.EncodeToBytes(h)
 	if err != nil {
 		return Hash{}, err
 	}
-	return sha256.Sum256(blockJSON), nil
+	return sha256.Sum256(headerRLP), nil
+}
+
+// Encode returns the record in its canonical binary encoding, RLP.
+func (b BlockFS) Encode() ([]byte, error) {
+	return rlp.EncodeToBytes(b)
+}
+
+// DecodeBlockFS decodes a record encoded by BlockFS.Encode.
+func DecodeBlockFS(data []byte) (BlockFS, error) {
+	var blockFS BlockFS
+	if err := rlp.DecodeBytes(data, &blockFS); err != nil {
+		return BlockFS{}, err
+	}
+	return blockFS, nil
+}
+
+// TrxRoot computes the Merkle root of the block transaction hashes.
+func (b Block) TrxRoot() (Hash, error) {
+	trxHashes, err := b.trxHashes()
+	if err != nil {
+		return Hash{}, err
+	}
+	return MerkleRoot(trxHashes), nil
+}
+
+// TrxProof returns the proof that the transaction is included in the block.
+func (b Block) TrxProof(trxHash Hash) (MerkleProof, error) {
+	trxHashes, err := b.trxHashes()
+	if err != nil {
+		return MerkleProof{}, err
+	}
+
+	for i, hash := range trxHashes {
+		if hash == trxHash {
+			return NewMerkleProof(trxHashes, i), nil
+		}
+	}
+
+	return MerkleProof{}, NewTrxNotFound(trxHash)
+}
+
+func (b Block) verifyTrxRoot() error {
+	trxRoot, err := b.TrxRoot()
+	if err != nil {
+		return err
+	}
+
+	if trxRoot != b.Header.TrxRoot {
+		return fmt.Errorf("block transactions root must be '%x' not '%x'", trxRoot, b.Header.TrxRoot)
+	}
+
+	return nil
+}
+
+func (b Block) trxHashes() ([]Hash, error) {
+	hashes := make([]Hash, len(b.TRXs))
+	for i, trx := range b.TRXs {
+		hash, err := trx.Hash()
+		if err != nil {
+			return nil, err
+		}
+		hashes[i] = hash
+	}
+	return hashes, nil
 }
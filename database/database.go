@@ -1,48 +1,111 @@
 package database
 
 import (
-	"bufio"
-	"encoding/json"
-	"os"
-	"reflect"
+	"fmt"
+	"maps"
+	"math"
+	"strconv"
 
-	"github.com/marc-watters/the-block-chain-bar/v2/fs"
+	"github.com/ethereum/go-ethereum/common"
 )
 
-func GetBlocksAfter(blockHash Hash, dataDir string) ([]Block, error) {
-	f, err := os.OpenFile(fs.GetBlocksDBFilePath(dataDir), os.O_RDONLY, 0o600)
+func (s *State) GetBlockByHeight(height uint64) (BlockFS, error) {
+	return s.store.BlockByHeight(height)
+}
+
+func (s *State) GetBlockByHash(hash Hash) (BlockFS, error) {
+	height, ok := s.store.BlockHeight(hash)
+	if !ok {
+		return BlockFS{}, NewBlockNotFound(hash.Hex())
+	}
+
+	return s.store.BlockByHeight(height)
+}
+
+// GetBlockByRef returns the block named by a decimal height or hex hash.
+func (s *State) GetBlockByRef(ref string) (BlockFS, error) {
+	if len(ref) == 2*len(Hash{}) {
+		var hash Hash
+		if err := hash.UnmarshalText([]byte(ref)); err != nil {
+			return BlockFS{}, fmt.Errorf("invalid block hash '%s': %v", ref, err)
+		}
+		return s.GetBlockByHash(hash)
+	}
+
+	height, err := strconv.ParseUint(ref, 10, 64)
 	if err != nil {
-		return nil, err
+		return BlockFS{}, fmt.Errorf("'%s' is neither a block height nor a block hash", ref)
 	}
+	return s.GetBlockByHeight(height)
+}
 
+// GetBlocks returns the blocks from height 'from' to 'to', capped to the
+// latest block.
+func (s *State) GetBlocks(from, to uint64) ([]Block, error) {
 	blocks := make([]Block, 0)
 
-	var shouldStartCollecting bool
-	if reflect.DeepEqual(blockHash, Hash{}) {
-		shouldStartCollecting = true
+	if s.store.Len() == 0 || from > to {
+		return blocks, nil
 	}
 
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		if err = scanner.Err(); err != nil {
-			return nil, err
-		}
+	if to >= s.store.Len() {
+		to = s.store.Len() - 1
+	}
 
-		var blockFs BlockFS
-		err = json.Unmarshal(scanner.Bytes(), &blockFs)
+	for height := from; height <= to; height++ {
+		blockFS, err := s.store.BlockByHeight(height)
 		if err != nil {
 			return nil, err
 		}
+		blocks = append(blocks, blockFS.Value)
+	}
 
-		if shouldStartCollecting {
-			blocks = append(blocks, blockFs.Value)
-			continue
-		}
+	return blocks, nil
+}
 
-		if blockHash == blockFs.Key {
-			shouldStartCollecting = true
+// GetBlocksAfter returns up to limit blocks following blockHash.
+func (s *State) GetBlocksAfter(blockHash Hash, limit uint64) ([]Block, error) {
+	from := uint64(0)
+	if !blockHash.IsEmpty() {
+		height, ok := s.store.BlockHeight(blockHash)
+		if !ok {
+			return nil, NewBlockNotFound(blockHash.Hex())
 		}
+		from = height + 1
 	}
 
-	return blocks, nil
+	if limit == 0 {
+		return make([]Block, 0), nil
+	}
+
+	return s.GetBlocks(from, from+min(limit-1, math.MaxUint64-from))
+}
+
+// BalancesAt returns the balances as of the block at height, and its hash.
+func (s *State) BalancesAt(height uint64) (map[common.Address]uint64, Hash, error) {
+	if height >= s.NextBlockHeight() {
+		return nil, Hash{}, NewBlockNotFound(fmt.Sprintf("%d", height))
+	}
+
+	if height == s.latestBlock.Header.Height {
+		return maps.Clone(s.balances), s.latestBlockHash, nil
+	}
+
+	past, err := s.rewind(height + 1)
+	if err != nil {
+		return nil, Hash{}, err
+	}
+
+	return past.balances, past.latestBlockHash, nil
+}
+
+// BalancesAtHash returns the balances as of the main chain block hash.
+func (s *State) BalancesAtHash(blockHash Hash) (map[common.Address]uint64, error) {
+	height, ok := s.store.BlockHeight(blockHash)
+	if !ok {
+		return nil, NewBlockNotFound(blockHash.Hex())
+	}
+
+	balances, _, err := s.BalancesAt(height)
+	return balances, err
 }
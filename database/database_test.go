@@ -0,0 +1,202 @@
+package database
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestBalancesAt(t *testing.T) {
+	dataDir := setupTestDataDirWithGenesis(t, testGenesisJSON)
+
+	s, err := NewStateFromDisk(dataDir, WithSnapshotInterval(2))
+	if err != nil {
+		t.Fatalf("error creating state: %v", err)
+	}
+	defer s.Close()
+
+	andrej := common.HexToAddress("0x3eb92807f1f91a8d4d85bc908c7f86dcddb1df57")
+
+	hashes := make([]Hash, 4)
+	var parent Hash
+	for height := range uint64(4) {
+		b := mineTestBlock(t, parent, height, 16, andrej, map[common.Address]uint64{andrej: (height + 1) * BlockReward})
+		parent = addTestBlock(t, s, b)
+		hashes[height] = parent
+	}
+
+	// Height 1 is replayed from genesis, height 3 from the snapshot at 2.
+	for height := range uint64(4) {
+		balances, blockHash, err := s.BalancesAt(height)
+		if err != nil {
+			t.Fatalf("error getting balances at height %d: %v", height, err)
+		}
+		if blockHash != hashes[height] {
+			t.Errorf("balances at height %d should be of block %s not %s", height, hashes[height].Hex(), blockHash.Hex())
+		}
+		if balances[andrej] != (height+1)*BlockReward {
+			t.Errorf("balance at height %d should be %d not %d", height, (height+1)*BlockReward, balances[andrej])
+		}
+	}
+
+	balances, err := s.BalancesAtHash(hashes[1])
+	if err != nil {
+		t.Fatalf("error getting balances at block %s: %v", hashes[1].Hex(), err)
+	}
+	if balances[andrej] != 2*BlockReward {
+		t.Errorf("balance at block %s should be %d not %d", hashes[1].Hex(), 2*BlockReward, balances[andrej])
+	}
+
+	var notFound ErrBlockNotFound
+	if _, _, err := s.BalancesAt(4); !errors.As(err, &notFound) {
+		t.Errorf("expected block not found error beyond the latest block, got: %v", err)
+	}
+
+	if s.Balances()[andrej] != 4*BlockReward {
+		t.Errorf("querying past balances should leave the latest balance untouched, got %d", s.Balances()[andrej])
+	}
+}
+
+func TestGetBlockByHeightAndHash(t *testing.T) {
+	dataDir := setupTestDataDirWithGenesis(t, testGenesisJSON)
+
+	s, err := NewStateFromDisk(dataDir)
+	if err != nil {
+		t.Fatalf("error creating state: %v", err)
+	}
+	defer s.Close()
+
+	andrej := common.HexToAddress("0x3eb92807f1f91a8d4d85bc908c7f86dcddb1df57")
+
+	var notFound ErrBlockNotFound
+	if _, err := s.GetBlockByHeight(0); !errors.As(err, &notFound) {
+		t.Errorf("expected block not found error on an empty chain, got: %v", err)
+	}
+
+	hashes := make([]Hash, 3)
+	var parent Hash
+	for height := range uint64(3) {
+		b := mineTestBlock(t, parent, height, 16, andrej, map[common.Address]uint64{andrej: (height + 1) * BlockReward})
+		parent = addTestBlock(t, s, b)
+		hashes[height] = parent
+	}
+
+	for height, hash := range hashes {
+		byHeight, err := s.GetBlockByHeight(uint64(height))
+		if err != nil {
+			t.Fatalf("error getting block at height %d: %v", height, err)
+		}
+		if byHeight.Key != hash || byHeight.Value.Header.Height != uint64(height) {
+			t.Errorf("block at height %d should be %s not %s", height, hash.Hex(), byHeight.Key.Hex())
+		}
+
+		byHash, err := s.GetBlockByHash(hash)
+		if err != nil {
+			t.Fatalf("error getting block %s: %v", hash.Hex(), err)
+		}
+		if byHash.Value.Header.Height != uint64(height) {
+			t.Errorf("block %s should be at height %d not %d", hash.Hex(), height, byHash.Value.Header.Height)
+		}
+	}
+
+	for _, height := range []uint64{3, math.MaxUint64} {
+		if _, err := s.GetBlockByHeight(height); !errors.As(err, &notFound) {
+			t.Errorf("expected block not found error at height %d, got: %v", height, err)
+		}
+	}
+	for _, hash := range []Hash{{}, {1}} {
+		if _, err := s.GetBlockByHash(hash); !errors.As(err, &notFound) {
+			t.Errorf("expected block not found error for %s, got: %v", hash.Hex(), err)
+		}
+	}
+}
+
+func TestGetBlocksAfter(t *testing.T) {
+	dataDir := setupTestDataDirWithGenesis(t, testGenesisJSON)
+
+	s, err := NewStateFromDisk(dataDir)
+	if err != nil {
+		t.Fatalf("error creating state: %v", err)
+	}
+	defer s.Close()
+
+	andrej := common.HexToAddress("0x3eb92807f1f91a8d4d85bc908c7f86dcddb1df57")
+
+	hashes := make([]Hash, 4)
+	var parent Hash
+	for height := range uint64(4) {
+		b := mineTestBlock(t, parent, height, 16, andrej, map[common.Address]uint64{andrej: (height + 1) * BlockReward})
+		parent = addTestBlock(t, s, b)
+		hashes[height] = parent
+	}
+
+	for _, tc := range []struct {
+		after      Hash
+		limit      uint64
+		fromHeight uint64
+		count      int
+	}{
+		{Hash{}, math.MaxUint64, 0, 4},
+		{Hash{}, 2, 0, 2},
+		{hashes[0], 2, 1, 2},
+		{hashes[1], math.MaxUint64, 2, 2},
+		{hashes[3], 10, 0, 0},
+		{hashes[0], 0, 0, 0},
+	} {
+		blocks, err := s.GetBlocksAfter(tc.after, tc.limit)
+		if err != nil {
+			t.Fatalf("error getting blocks after %s: %v", tc.after.Hex(), err)
+		}
+		if len(blocks) != tc.count || (tc.count > 0 && blocks[0].Header.Height != tc.fromHeight) {
+			t.Errorf("expected %d blocks from height %d after %s limited to %d, got %d", tc.count, tc.fromHeight, tc.after.Hex(), tc.limit, len(blocks))
+		}
+	}
+
+	var notFound ErrBlockNotFound
+	if _, err := s.GetBlocksAfter(Hash{1}, 10); !errors.As(err, &notFound) {
+		t.Errorf("expected block not found error for an unknown block, got: %v", err)
+	}
+}
+
+func TestGetBlockByRef(t *testing.T) {
+	dataDir := setupTestDataDirWithGenesis(t, testGenesisJSON)
+
+	s, err := NewStateFromDisk(dataDir)
+	if err != nil {
+		t.Fatalf("error creating state: %v", err)
+	}
+	defer s.Close()
+
+	andrej := common.HexToAddress("0x3eb92807f1f91a8d4d85bc908c7f86dcddb1df57")
+
+	var parent Hash
+	for height := range uint64(2) {
+		b := mineTestBlock(t, parent, height, 16, andrej, map[common.Address]uint64{andrej: (height + 1) * BlockReward})
+		parent = addTestBlock(t, s, b)
+	}
+
+	for _, ref := range []string{"1", parent.Hex()} {
+		blockFS, err := s.GetBlockByRef(ref)
+		if err != nil {
+			t.Fatalf("error getting block '%s': %v", ref, err)
+		}
+		if blockFS.Key != parent {
+			t.Errorf("block '%s' should be %s not %s", ref, parent.Hex(), blockFS.Key.Hex())
+		}
+	}
+
+	var notFound ErrBlockNotFound
+	for _, ref := range []string{"2", Hash{1}.Hex()} {
+		if _, err := s.GetBlockByRef(ref); !errors.As(err, &notFound) {
+			t.Errorf("expected block not found error for '%s', got: %v", ref, err)
+		}
+	}
+
+	for _, ref := range []string{"", "-1", "0x01", parent.Hex()[:63] + "z"} {
+		if _, err := s.GetBlockByRef(ref); err == nil || errors.As(err, &notFound) {
+			t.Errorf("expected '%s' to be rejected as a block reference, got: %v", ref, err)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package database
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"time"
+)
+
+const (
+	// DefaultDifficulty roughly matches the former three leading zero bytes rule.
+	DefaultDifficulty = 1 << 24
+	// DefaultBlockTime is the targeted block interval, in seconds.
+	DefaultBlockTime = 30
+	// DefaultRetargetInterval is the number of blocks between retargets.
+	DefaultRetargetInterval = 20
+
+	// maxRetargetFactor bounds a single retarget either way.
+	maxRetargetFactor = 4
+)
+
+// ChainParams are the consensus parameters set in the genesis.
+type ChainParams struct {
+	Difficulty       uint64 `json:"difficulty"`
+	BlockTime        uint64 `json:"block_time"`
+	RetargetInterval uint64 `json:"retarget_interval"`
+}
+
+// withDefaults fills in the parameters a genesis file leaves unset.
+func (p ChainParams) withDefaults() ChainParams {
+	if p.Difficulty == 0 {
+		p.Difficulty = DefaultDifficulty
+	}
+	if p.BlockTime == 0 {
+		p.BlockTime = DefaultBlockTime
+	}
+	return p
+}
+
+func (p ChainParams) validate() error {
+	if p.RetargetInterval == 1 {
+		return fmt.Errorf("retarget interval must be 0 or span at least 2 blocks")
+	}
+	return nil
+}
+
+// MeetsDifficulty reports whether the hash is below 2^256 / difficulty.
+func (h Hash) MeetsDifficulty(difficulty uint64) bool {
+	if difficulty == 0 {
+		return false
+	}
+
+	target := new(big.Int).Lsh(big.NewInt(1), 256)
+	target.Div(target, new(big.Int).SetUint64(difficulty))
+
+	return new(big.Int).SetBytes(h[:]).Cmp(target) < 0
+}
+
+// NextBlockDifficulty returns the difficulty the next block must carry.
+func (s *State) NextBlockDifficulty() uint64 {
+	next := s.NextBlockHeight()
+	if next == 0 {
+		return s.params.Difficulty
+	}
+
+	latest := s.latestBlock.Header
+	if s.params.RetargetInterval == 0 || next%s.params.RetargetInterval != 0 {
+		return latest.Difficulty
+	}
+
+	var actual uint64
+	if latest.Time > s.periodStart {
+		actual = latest.Time - s.periodStart
+	}
+	expected := (s.params.RetargetInterval - 1) * s.params.BlockTime * uint64(time.Second)
+
+	return retarget(latest.Difficulty, actual, expected)
+}
+
+// difficultyAfter returns the difficulty of a block extending any known
+// block.
+func (s *State) difficultyAfter(parent Hash) (uint64, error) {
+	if parent.IsEmpty() {
+		return s.params.Difficulty, nil
+	}
+
+	latest, err := s.knownHeader(parent)
+	if err != nil {
+		return 0, err
+	}
+
+	next := latest.Height + 1
+	if s.params.RetargetInterval == 0 || next%s.params.RetargetInterval != 0 {
+		return latest.Difficulty, nil
+	}
+
+	start := latest
+	for start.Height > next-s.params.RetargetInterval {
+		if start, err = s.knownHeader(start.Parent); err != nil {
+			return 0, err
+		}
+	}
+
+	var actual uint64
+	if latest.Time > start.Time {
+		actual = latest.Time - start.Time
+	}
+	expected := (s.params.RetargetInterval - 1) * s.params.BlockTime * uint64(time.Second)
+
+	return retarget(latest.Difficulty, actual, expected), nil
+}
+
+// retarget scales difficulty by expected/actual.
+func retarget(difficulty, actual, expected uint64) uint64 {
+	actual = max(actual, expected/maxRetargetFactor, 1)
+	actual = min(actual, expected*maxRetargetFactor)
+
+	next := new(big.Int).SetUint64(difficulty)
+	next.Mul(next, new(big.Int).SetUint64(expected))
+	next.Div(next, new(big.Int).SetUint64(actual))
+
+	if !next.IsUint64() {
+		return math.MaxUint64
+	}
+
+	return max(next.Uint64(), 1)
+}
@@ -0,0 +1,80 @@
+package database
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestNextBlockDifficulty_Retargets(t *testing.T) {
+	dataDir := setupTestDataDirWithGenesis(t,
+		`{"chain_id": "tbb-test", "difficulty": 16, "block_time": 10, "retarget_interval": 4, "balances": {}}`)
+
+	s, err := NewStateFromDisk(dataDir)
+	if err != nil {
+		t.Fatalf("error creating state: %v", err)
+	}
+
+	miner := common.HexToAddress("0x3eb92807f1f91a8d4d85bc908c7f86dcddb1df57")
+	start := uint64(time.Now().UnixNano())
+
+	// The first period of 4 blocks spans 15s instead of the expected 30s.
+	var parent Hash
+	for height := uint64(0); height < 4; height++ {
+		if s.NextBlockDifficulty() != 16 {
+			t.Fatalf("difficulty of block %d should be 16 not %d", height, s.NextBlockDifficulty())
+		}
+		balances := map[common.Address]uint64{miner: (height + 1) * BlockReward}
+		b := mineTestBlockAt(t, parent, height, 16, start+height*uint64(5*time.Second), miner, balances)
+		parent = addTestBlock(t, s, b)
+	}
+
+	if s.NextBlockDifficulty() != 32 {
+		t.Fatalf("difficulty should double to 32 not %d", s.NextBlockDifficulty())
+	}
+	if difficulty, err := s.difficultyAfter(parent); err != nil || difficulty != 32 {
+		t.Fatalf("a side chain forking off the latest block should retarget to 32 too, got %d: %v", difficulty, err)
+	}
+
+	stale := mineTestBlockAt(t, parent, 4, 16, start+uint64(20*time.Second), miner, map[common.Address]uint64{miner: 5 * BlockReward})
+	if _, err := s.AddBlock(stale); err == nil {
+		t.Errorf("expected block not carrying the retargeted difficulty to be rejected")
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatalf("error closing state: %v", err)
+	}
+
+	reloaded, err := NewStateFromDisk(dataDir)
+	if err != nil {
+		t.Fatalf("error reloading state: %v", err)
+	}
+	defer reloaded.Close()
+
+	if reloaded.NextBlockDifficulty() != 32 {
+		t.Errorf("reloaded difficulty should be 32 not %d", reloaded.NextBlockDifficulty())
+	}
+}
+
+func TestRetarget_IsBounded(t *testing.T) {
+	if got := retarget(100, 1, 1000); got != 100*maxRetargetFactor {
+		t.Errorf("difficulty should rise at most %dx to %d not %d", maxRetargetFactor, 100*maxRetargetFactor, got)
+	}
+	if got := retarget(100, 1000000, 1000); got != 100/maxRetargetFactor {
+		t.Errorf("difficulty should drop at most %dx to %d not %d", maxRetargetFactor, 100/maxRetargetFactor, got)
+	}
+	if got := retarget(1, 1000000, 1000); got != 1 {
+		t.Errorf("difficulty should not drop below 1, got %d", got)
+	}
+}
+
+func TestAddWork_Saturates(t *testing.T) {
+	if got := addWork(math.MaxUint64-1, retarget(math.MaxUint64, 1, 1000)); got != math.MaxUint64 {
+		t.Errorf("chain work should saturate at %d not wrap to %d", uint64(math.MaxUint64), got)
+	}
+	if got := addWork(1, 2); got != 3 {
+		t.Errorf("chain work should be 3 not %d", got)
+	}
+}
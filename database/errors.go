@@ -1,6 +1,10 @@
 package database
 
-import "fmt"
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+)
 
 type (
 	ErrInsufficientBalance struct {
@@ -11,12 +15,127 @@ type (
 	ErrInvalidTransaction struct {
 		field string
 	}
+	ErrBlockNotFound struct {
+		ref string
+	}
+	ErrStateNotFound struct {
+		key string
+	}
+	ErrBlockExists struct {
+		hash Hash
+	}
+	ErrInvalidNonce struct {
+		Account  common.Address
+		Expected uint64
+		Got      uint64
+	}
+	ErrTrxNotFound struct {
+		hash Hash
+	}
+	ErrBlockTooOld struct {
+		Time           uint64
+		MedianTimePast uint64
+	}
+	ErrBlockInFuture struct {
+		Time    uint64
+		MaxTime uint64
+	}
+	ErrTrxInFuture struct {
+		Time    uint64
+		MaxTime uint64
+	}
+	ErrTooManyTRXs struct {
+		Count int
+		Max   int
+	}
+	ErrBlockTooLarge struct {
+		Size int
+		Max  int
+	}
+	ErrTrxDataTooLong struct {
+		Len int
+		Max int
+	}
+	ErrFeeTooLow struct {
+		Min uint64
+		Got uint64
+	}
+	ErrLegacyBlocksDB struct {
+		path string
+	}
+	ErrLegacyDataDir struct {
+		dataDir string
+	}
+	ErrBlockPruned struct {
+		Height uint64
+		Base   uint64
+	}
 )
 
 func NewInvalidTransaction(field string) ErrInvalidTransaction {
 	return ErrInvalidTransaction{field}
 }
 
+func NewBlockNotFound(ref string) ErrBlockNotFound {
+	return ErrBlockNotFound{ref}
+}
+
+func NewStateNotFound(key string) ErrStateNotFound {
+	return ErrStateNotFound{key}
+}
+
+func NewBlockExists(hash Hash) ErrBlockExists {
+	return ErrBlockExists{hash}
+}
+
+func NewInvalidNonce(account common.Address, expected, got uint64) ErrInvalidNonce {
+	return ErrInvalidNonce{account, expected, got}
+}
+
+func NewTrxNotFound(hash Hash) ErrTrxNotFound {
+	return ErrTrxNotFound{hash}
+}
+
+func NewBlockTooOld(time, medianTimePast uint64) ErrBlockTooOld {
+	return ErrBlockTooOld{time, medianTimePast}
+}
+
+func NewBlockInFuture(time, maxTime uint64) ErrBlockInFuture {
+	return ErrBlockInFuture{time, maxTime}
+}
+
+func NewTrxInFuture(time, maxTime uint64) ErrTrxInFuture {
+	return ErrTrxInFuture{time, maxTime}
+}
+
+func NewTooManyTRXs(count, max int) ErrTooManyTRXs {
+	return ErrTooManyTRXs{count, max}
+}
+
+func NewBlockTooLarge(size, max int) ErrBlockTooLarge {
+	return ErrBlockTooLarge{size, max}
+}
+
+func NewTrxDataTooLong(len, max int) ErrTrxDataTooLong {
+	return ErrTrxDataTooLong{len, max}
+}
+
+func NewFeeTooLow(min, got uint64) ErrFeeTooLow {
+	return ErrFeeTooLow{min, got}
+}
+
+func NewLegacyBlocksDB(path string) ErrLegacyBlocksDB {
+	return ErrLegacyBlocksDB{path}
+}
+
+func NewLegacyDataDir(dataDir string) ErrLegacyDataDir {
+	return ErrLegacyDataDir{dataDir}
+}
+
+func NewBlockPruned(height, base uint64) ErrBlockPruned {
+	return ErrBlockPruned{height, base}
+}
+
 func (e ErrInsufficientBalance) Error() string {
 	return "insufficient balance"
 }
@@ -24,3 +143,63 @@ func (e ErrInsufficientBalance) Error() string {
 func (e ErrInvalidTransaction) Error() string {
 	return fmt.Sprintf("invalid value for field: '%s'", e.field)
 }
+
+func (e ErrBlockNotFound) Error() string {
+	return fmt.Sprintf("block '%s' not found", e.ref)
+}
+
+func (e ErrStateNotFound) Error() string {
+	return fmt.Sprintf("state '%s' not found", e.key)
+}
+
+func (e ErrBlockExists) Error() string {
+	return fmt.Sprintf("block '%s' already exists", e.hash.Hex())
+}
+
+func (e ErrInvalidNonce) Error() string {
+	return fmt.Sprintf("next nonce of account '%s' must be '%d' not '%d'", e.Account.String(), e.Expected, e.Got)
+}
+
+func (e ErrTrxNotFound) Error() string {
+	return fmt.Sprintf("transaction '%s' not found", e.hash.Hex())
+}
+
+func (e ErrBlockTooOld) Error() string {
+	return fmt.Sprintf("block time '%d' must be after the median time past '%d'", e.Time, e.MedianTimePast)
+}
+
+func (e ErrBlockInFuture) Error() string {
+	return fmt.Sprintf("block time '%d' is too far in the future, must be at most '%d'", e.Time, e.MaxTime)
+}
+
+func (e ErrTrxInFuture) Error() string {
+	return fmt.Sprintf("transaction time '%d' is in the future, must be at most '%d'", e.Time, e.MaxTime)
+}
+
+func (e ErrTooManyTRXs) Error() string {
+	return fmt.Sprintf("block holds '%d' transactions, at most '%d' are allowed", e.Count, e.Max)
+}
+
+func (e ErrBlockTooLarge) Error() string {
+	return fmt.Sprintf("block size '%d' exceeds the maximum of '%d' bytes", e.Size, e.Max)
+}
+
+func (e ErrTrxDataTooLong) Error() string {
+	return fmt.Sprintf("transaction data length '%d' exceeds the maximum of '%d' bytes", e.Len, e.Max)
+}
+
+func (e ErrFeeTooLow) Error() string {
+	return fmt.Sprintf("transaction fee must be at least '%d' not '%d'", e.Min, e.Got)
+}
+
+func (e ErrLegacyBlocksDB) Error() string {
+	return fmt.Sprintf("'%s' holds JSON records, run 'tbb db migrate blocks' to convert it to the binary format", e.path)
+}
+
+func (e ErrLegacyDataDir) Error() string {
+	return fmt.Sprintf("'%s' holds a legacy v1 database, run 'tbb db migrate v1 --accounts <mapping file>' to convert it", e.dataDir)
+}
+
+func (e ErrBlockPruned) Error() string {
+	return fmt.Sprintf("block at height '%d' was pruned, blocks are stored from height '%d'", e.Height, e.Base)
+}
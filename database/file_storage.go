@@ -0,0 +1,510 @@
+package database
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/spf13/afero"
+
+	"github.com/marc-watters/the-block-chain-bar/v2/fs"
+)
+
+// blocksDBMagic starts a block.db holding binary records, see
+// MigrateBlocksDB for older ones.
+var blocksDBMagic = []byte("TBB\x01")
+
+// fileStorage appends the binary BlockFS records to block.db and seals
+// them into compressed segments. State values are one file per key.
+type fileStorage struct {
+	db          afero.File
+	dbPath      string
+	dbSize      int64
+	index       blockIndex
+	segmentsDir string
+	manifest    segmentManifest
+	cache       segmentCache
+	cacheMu     sync.Mutex
+	stateDir    string
+	sync        bool
+	recovery    Recovery
+	recovered   bool
+	readOnly    bool
+	damage      Damage
+	damaged     bool
+}
+
+// blockRef locates a BlockFS record in a sealed segment or block.db.
+type blockRef struct {
+	segment int
+	offset  int64
+	size    int64
+}
+
+// blockIndex maps block heights and hashes to the position of their
+// record, from height base on.
+type blockIndex struct {
+	base    uint64
+	refs    []blockRef
+	heights map[Hash]uint64
+}
+
+// openFileStorage opens the block storage of a data directory. Read-only,
+// indexing stops at the first unreadable record.
+func openFileStorage(dataDir string, sync bool, segmentSize int64, readOnly bool) (*fileStorage, error) {
+	dbPath := fs.GetBlocksDBFilePath(dataDir)
+
+	flag := os.O_APPEND | os.O_RDWR
+	if readOnly {
+		flag = os.O_RDONLY
+	}
+
+	db, err := fs.AppFS.OpenFile(dbPath, flag, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &fileStorage{
+		db:          db,
+		dbPath:      dbPath,
+		dbSize:      int64(len(blocksDBMagic)),
+		index:       newBlockIndex(),
+		segmentsDir: fs.GetSegmentsDirPath(dataDir),
+		cache:       segmentCache{},
+		stateDir:    fs.GetStateDirPath(dataDir),
+		sync:        sync,
+		readOnly:    readOnly,
+	}
+
+	if err := s.open(segmentSize); err != nil {
+		s.db.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *fileStorage) open(segmentSize int64) error {
+	if err := s.checkHeader(); err != nil {
+		return err
+	}
+
+	if err := s.loadManifest(segmentSize); err != nil {
+		return err
+	}
+
+	if err := s.indexSegments(); err != nil {
+		return err
+	}
+	if s.damaged {
+		return nil
+	}
+	if s.manifest.Unsealing != nil {
+		if err := s.resumeUnseal(); err != nil || s.damaged {
+			return err
+		}
+	}
+
+	if err := s.buildIndex(); err != nil {
+		return err
+	}
+	if s.readOnly {
+		return nil
+	}
+
+	return s.sealFullSegments()
+}
+
+// damagedAt fails a writable storage and marks a read-only one damaged.
+func (s *fileStorage) damagedAt(err error) error {
+	if !s.readOnly {
+		return err
+	}
+
+	s.damage = Damage{s.index.len(), err.Error()}
+	s.damaged = true
+
+	return nil
+}
+
+// checkHeader writes the header of a new block.db and rejects JSON ones.
+func (s *fileStorage) checkHeader() error {
+	header := make([]byte, len(blocksDBMagic))
+	n, err := s.db.ReadAt(header, 0)
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	if bytes.Equal(header[:n], blocksDBMagic) {
+		return nil
+	}
+	if !bytes.HasPrefix(blocksDBMagic, header[:n]) {
+		return NewLegacyBlocksDB(s.dbPath)
+	}
+	// A block.db whose header was never written holds no blocks.
+	if s.readOnly {
+		return nil
+	}
+
+	if err := s.db.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := s.db.Write(blocksDBMagic); err != nil {
+		return err
+	}
+
+	return s.db.Sync()
+}
+
+func (s *fileStorage) AppendBlock(blockFS BlockFS) error {
+	if s.readOnly {
+		return errReadOnlyStorage
+	}
+
+	record, err := blockFS.Encode()
+	if err != nil {
+		return err
+	}
+
+	if blockFS.Value.Header.Height != s.index.len() {
+		return fmt.Errorf("next stored block height must be '%d' not '%d'", s.index.len(), blockFS.Value.Header.Height)
+	}
+
+	if _, err := s.db.Write(record); err != nil {
+		// Don't leave a torn record before the next append.
+		if truncErr := s.db.Truncate(s.dbSize); truncErr != nil {
+			return fmt.Errorf("%v: unable to discard partial record: %v", err, truncErr)
+		}
+		return err
+	}
+
+	if s.sync {
+		if err := s.db.Sync(); err != nil {
+			return err
+		}
+	}
+
+	ref := blockRef{activeSegment, s.dbSize, int64(len(record))}
+	s.dbSize += ref.size
+
+	if err := s.index.add(blockFS.Value.Header.Height, blockFS.Key, ref); err != nil {
+		return err
+	}
+
+	return s.sealFullSegments()
+}
+
+func (s *fileStorage) BlockByHeight(height uint64) (BlockFS, error) {
+	ref, ok := s.index.ref(height)
+	if !ok && height < s.index.base {
+		return BlockFS{}, NewBlockPruned(height, s.index.base)
+	}
+	if !ok {
+		return BlockFS{}, NewBlockNotFound(fmt.Sprintf("%d", height))
+	}
+
+	if ref.segment != activeSegment {
+		data, err := s.segment(ref.segment)
+		if err != nil {
+			return BlockFS{}, err
+		}
+		return DecodeBlockFS(data[ref.offset : ref.offset+ref.size])
+	}
+
+	record := make([]byte, ref.size)
+	if _, err := s.db.ReadAt(record, ref.offset); err != nil {
+		return BlockFS{}, err
+	}
+
+	return DecodeBlockFS(record)
+}
+
+func (s *fileStorage) BlockHeight(hash Hash) (uint64, bool) {
+	return s.index.height(hash)
+}
+
+func (s *fileStorage) Len() uint64 {
+	return s.index.len()
+}
+
+func (s *fileStorage) Base() uint64 {
+	return s.index.base
+}
+
+func (s *fileStorage) Truncate(length uint64) error {
+	if s.readOnly {
+		return errReadOnlyStorage
+	}
+	if length < s.index.base {
+		return NewBlockPruned(length, s.index.base)
+	}
+
+	ref, ok := s.index.ref(length)
+	if !ok {
+		return nil
+	}
+
+	if ref.segment != activeSegment {
+		return s.truncateSegments(length)
+	}
+
+	if err := s.db.Truncate(ref.offset); err != nil {
+		return err
+	}
+
+	if err := s.db.Sync(); err != nil {
+		return err
+	}
+
+	s.dbSize = ref.offset
+	s.index.truncate(length)
+
+	return nil
+}
+
+func (s *fileStorage) PutState(key string, value []byte) error {
+	if s.readOnly {
+		return errReadOnlyStorage
+	}
+	if err := fs.AppFS.MkdirAll(s.stateDir, os.ModePerm); err != nil {
+		return err
+	}
+
+	return writeFileAtomic(filepath.Join(s.stateDir, key), value, s.sync)
+}
+
+func (s *fileStorage) GetState(key string) ([]byte, error) {
+	value, err := fs.AppFS.ReadFile(filepath.Join(s.stateDir, key))
+	if os.IsNotExist(err) {
+		return nil, NewStateNotFound(key)
+	}
+	return value, err
+}
+
+func (s *fileStorage) DeleteState(key string) error {
+	if s.readOnly {
+		return errReadOnlyStorage
+	}
+
+	err := fs.AppFS.Remove(filepath.Join(s.stateDir, key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (s *fileStorage) Recovered() (Recovery, bool) {
+	return s.recovery, s.recovered
+}
+
+func (s *fileStorage) Damaged() (Damage, bool) {
+	return s.damage, s.damaged
+}
+
+func (s *fileStorage) Close() error {
+	return s.db.Close()
+}
+
+// writeFileAtomic replaces the file at path through a temporary file so it
+// is never left partially written.
+func writeFileAtomic(path string, content []byte, sync bool) error {
+	f, err := fs.AppFS.OpenFile(path+".tmp", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(content); err != nil {
+		f.Close()
+		return err
+	}
+
+	if sync {
+		if err := f.Sync(); err != nil {
+			f.Close()
+			return err
+		}
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return fs.AppFS.Rename(path+".tmp", path)
+}
+
+func (s *fileStorage) buildIndex() error {
+	info, err := s.db.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() <= s.dbSize {
+		return nil
+	}
+
+	if _, err := s.db.Seek(s.dbSize, io.SeekStart); err != nil {
+		return err
+	}
+
+	// Records claiming to be longer than the file fail instead of being read.
+	stream := rlp.NewStream(bufio.NewReader(s.db), uint64(info.Size()-s.dbSize))
+	headerSize := int64(len(blocksDBMagic))
+	staleEnd := headerSize
+	for {
+		record, err := stream.Raw()
+		if err == io.EOF {
+			break
+		}
+
+		// An interrupted append leaves a torn last record behind.
+		if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, rlp.ErrValueTooLarge) {
+			if err := s.discardTornRecord(s.dbSize, info.Size()); err != nil {
+				return err
+			}
+			break
+		}
+		if err != nil {
+			return s.damagedAt(fmt.Errorf("corrupted block record at offset %d: %v", s.dbSize, err))
+		}
+
+		ref := blockRef{activeSegment, s.dbSize, int64(len(record))}
+
+		blockFS, decodeErr := DecodeBlockFS(record)
+		if decodeErr != nil && ref.offset+ref.size == info.Size() {
+			if err := s.discardTornRecord(ref.offset, info.Size()); err != nil {
+				return err
+			}
+			break
+		}
+		if decodeErr != nil {
+			return s.damagedAt(fmt.Errorf("corrupted block record at offset %d: %v", ref.offset, decodeErr))
+		}
+
+		s.dbSize += ref.size
+
+		// Left behind by an interrupted seal, truncation or prune.
+		if blockFS.Value.Header.Height < s.manifest.sealedLen() {
+			staleEnd = s.dbSize
+			continue
+		}
+
+		if err := s.index.add(blockFS.Value.Header.Height, blockFS.Key, ref); err != nil {
+			return s.damagedAt(err)
+		}
+	}
+
+	if staleEnd > headerSize && !s.readOnly {
+		return s.dropStaleRecords(staleEnd)
+	}
+
+	return nil
+}
+
+// dropStaleRecords rewrites block.db without the records before staleEnd.
+func (s *fileStorage) dropStaleRecords(staleEnd int64) error {
+	headerSize := int64(len(blocksDBMagic))
+
+	rest := make([]byte, s.dbSize-staleEnd)
+	if _, err := s.db.ReadAt(rest, staleEnd); err != nil {
+		return err
+	}
+
+	if err := s.rewriteActive(rest); err != nil {
+		return err
+	}
+
+	for height := s.manifest.sealedLen(); height < s.index.len(); height++ {
+		s.index.at(height).offset -= staleEnd - headerSize
+	}
+
+	return nil
+}
+
+func (s *fileStorage) discardTornRecord(offset int64, size int64) error {
+	record := make([]byte, size-offset)
+	if _, err := s.db.ReadAt(record, offset); err != nil && err != io.EOF {
+		return err
+	}
+
+	s.recovery = Recovery{Offset: offset, Discarded: record}
+	s.recovered = true
+
+	if s.readOnly {
+		return nil
+	}
+
+	if err := s.db.Truncate(offset); err != nil {
+		return err
+	}
+
+	if err := s.db.Sync(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func newBlockIndex() blockIndex {
+	return blockIndex{
+		base:    0,
+		refs:    make([]blockRef, 0),
+		heights: make(map[Hash]uint64),
+	}
+}
+
+func (idx *blockIndex) add(height uint64, hash Hash, ref blockRef) error {
+	if height != idx.len() {
+		return fmt.Errorf("next indexed block height must be '%d' not '%d'", idx.len(), height)
+	}
+
+	idx.refs = append(idx.refs, ref)
+	idx.heights[hash] = height
+
+	return nil
+}
+
+func (idx *blockIndex) truncate(length uint64) {
+	for hash, height := range idx.heights {
+		if height >= length {
+			delete(idx.heights, hash)
+		}
+	}
+	idx.refs = idx.refs[:length-idx.base]
+}
+
+// prune drops the blocks below height base.
+func (idx *blockIndex) prune(base uint64) {
+	for hash, height := range idx.heights {
+		if height < base {
+			delete(idx.heights, hash)
+		}
+	}
+	idx.refs = idx.refs[base-idx.base:]
+	idx.base = base
+}
+
+func (idx *blockIndex) ref(height uint64) (blockRef, bool) {
+	if height < idx.base || height >= idx.len() {
+		return blockRef{}, false
+	}
+	return idx.refs[height-idx.base], true
+}
+
+// at returns the ref of a stored block for updating it in place.
+func (idx *blockIndex) at(height uint64) *blockRef {
+	return &idx.refs[height-idx.base]
+}
+
+func (idx *blockIndex) height(hash Hash) (uint64, bool) {
+	height, ok := idx.heights[hash]
+	return height, ok
+}
+
+func (idx *blockIndex) len() uint64 {
+	return idx.base + uint64(len(idx.refs))
+}
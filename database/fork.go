@@ -0,0 +1,309 @@
+package database
+
+import (
+	"fmt"
+	"maps"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const (
+	// maxForkDepth is how deep below the latest block side chains may fork.
+	maxForkDepth = 100
+	// maxSideBlocks bounds how many side chain blocks are tracked at once.
+	maxSideBlocks = 1000
+)
+
+// sideBlock is a side chain block with the total work of its chain.
+type sideBlock struct {
+	block     Block
+	chainWork uint64
+}
+
+func (s *State) addSideBlock(hash Hash, b Block) error {
+	difficulty, err := s.difficultyAfter(b.Header.Parent)
+	if err != nil {
+		return err
+	}
+	if b.Header.Difficulty != difficulty {
+		return fmt.Errorf("side chain block difficulty must be '%d' not '%d'", difficulty, b.Header.Difficulty)
+	}
+
+	if !hash.MeetsDifficulty(b.Header.Difficulty) {
+		return fmt.Errorf("block hash %x doesn't meet difficulty %d", hash, b.Header.Difficulty)
+	}
+
+	if err := b.checkLimits(); err != nil {
+		return err
+	}
+
+	if err := b.verifyTrxRoot(); err != nil {
+		return err
+	}
+
+	nextHeight, parentWork, err := s.chainTip(b.Header.Parent)
+	if err != nil {
+		return err
+	}
+
+	if b.Header.Height != nextHeight {
+		return fmt.Errorf("next expected side chain block height must be '%d' not '%d'",
+			nextHeight,
+			b.Header.Height,
+		)
+	}
+
+	s.pruneSideBlocks()
+	if len(s.sideBlocks) >= maxSideBlocks {
+		return fmt.Errorf("already tracking %d side chain blocks", len(s.sideBlocks))
+	}
+
+	side := sideBlock{b, addWork(parentWork, b.Work())}
+	s.sideBlocks[hash] = side
+
+	fmt.Printf("Tracking side chain block '%x' at height %d\n", hash, b.Header.Height)
+
+	if side.chainWork <= s.chainWork {
+		return nil
+	}
+
+	return s.reorganize(hash)
+}
+
+// chainTip returns the height following a known block and the work of its
+// chain. The empty hash stands for "before genesis".
+func (s *State) chainTip(hash Hash) (nextHeight uint64, chainWork uint64, err error) {
+	if hash.IsEmpty() {
+		return 0, 0, nil
+	}
+
+	if side, ok := s.sideBlocks[hash]; ok {
+		return side.block.Header.Height + 1, side.chainWork, nil
+	}
+
+	height, ok := s.store.BlockHeight(hash)
+	if !ok {
+		return 0, 0, fmt.Errorf("unknown parent block '%x'", hash)
+	}
+
+	chainWork = s.chainWork
+	for h := s.store.Len() - 1; h > height; h-- {
+		blockFS, err := s.store.BlockByHeight(h)
+		if err != nil {
+			return 0, 0, err
+		}
+		chainWork -= min(chainWork, blockFS.Value.Work())
+	}
+
+	return height + 1, chainWork, nil
+}
+
+// knownHeader returns the header of a side chain or stored block.
+func (s *State) knownHeader(hash Hash) (BlockHeader, error) {
+	if side, ok := s.sideBlocks[hash]; ok {
+		return side.block.Header, nil
+	}
+
+	blockFS, err := s.GetBlockByHash(hash)
+	if err != nil {
+		return BlockHeader{}, err
+	}
+	return blockFS.Value.Header, nil
+}
+
+// reorganize switches the main chain over to the side chain ending with
+// tip, validating it before block storage is rewritten.
+func (s *State) reorganize(tip Hash) error {
+	branch := make([]BlockFS, 0)
+	for hash := tip; ; {
+		side, ok := s.sideBlocks[hash]
+		if !ok {
+			break
+		}
+		branch = append([]BlockFS{{hash, side.block}}, branch...)
+		hash = side.block.Header.Parent
+	}
+
+	forkHeight := branch[0].Value.Header.Height
+
+	pendingState, err := s.rewind(forkHeight)
+	if err != nil {
+		return err
+	}
+	forkWork := pendingState.chainWork
+
+	for i, blockFS := range branch {
+		if err := applyBlock(blockFS.Value, &pendingState); err != nil {
+			for _, invalid := range branch[i:] {
+				delete(s.sideBlocks, invalid.Key)
+			}
+			return fmt.Errorf("side chain block '%x' rejected: %w", blockFS.Key, err)
+		}
+	}
+
+	replaced := make([]BlockFS, 0)
+	for height := forkHeight; height < s.store.Len(); height++ {
+		blockFS, err := s.store.BlockByHeight(height)
+		if err != nil {
+			return err
+		}
+		replaced = append(replaced, blockFS)
+	}
+
+	orphaned, err := orphanedTRXs(replaced, branch)
+	if err != nil {
+		return err
+	}
+
+	if err := s.replaceBlocks(forkHeight, branch); err != nil {
+		if restoreErr := s.replaceBlocks(forkHeight, replaced); restoreErr != nil {
+			return fmt.Errorf("%w, restoring the replaced blocks failed: %v", err, restoreErr)
+		}
+		return err
+	}
+
+	for _, blockFS := range branch {
+		delete(s.sideBlocks, blockFS.Key)
+	}
+
+	work := forkWork
+	for _, blockFS := range replaced {
+		work = addWork(work, blockFS.Value.Work())
+		s.sideBlocks[blockFS.Key] = sideBlock{blockFS.Value, work}
+	}
+
+	s.commit(pendingState)
+	s.orphanedTRXs = append(s.orphanedTRXs, orphaned...)
+
+	fmt.Printf("Chain reorganized at height %d: replaced %d blocks with %d blocks, new latest block '%x'\n",
+		forkHeight,
+		len(replaced),
+		len(branch),
+		s.latestBlockHash,
+	)
+
+	return nil
+}
+
+// replaceBlocks swaps the stored blocks from forkHeight onwards for branch.
+func (s *State) replaceBlocks(forkHeight uint64, branch []BlockFS) error {
+	if err := s.unindexBlocks(forkHeight); err != nil {
+		return err
+	}
+	if err := s.store.Truncate(forkHeight); err != nil {
+		return err
+	}
+
+	for _, blockFS := range branch {
+		if err := s.persistBlock(blockFS); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// orphanedTRXs returns the replaced transactions the branch doesn't include.
+func orphanedTRXs(replaced, branch []BlockFS) ([]SignedTrx, error) {
+	included := make(map[Hash]bool)
+	for _, blockFS := range branch {
+		for _, trx := range blockFS.Value.TRXs {
+			trxHash, err := trx.Hash()
+			if err != nil {
+				return nil, err
+			}
+			included[trxHash] = true
+		}
+	}
+
+	orphaned := make([]SignedTrx, 0)
+	for _, blockFS := range replaced {
+		for _, trx := range blockFS.Value.TRXs {
+			trxHash, err := trx.Hash()
+			if err != nil {
+				return nil, err
+			}
+			if !included[trxHash] {
+				orphaned = append(orphaned, trx)
+			}
+		}
+	}
+
+	return orphaned, nil
+}
+
+// TakeOrphanedTRXs returns the transactions reorganizations dropped since
+// the last call.
+func (s *State) TakeOrphanedTRXs() []SignedTrx {
+	orphaned := s.orphanedTRXs
+	s.orphanedTRXs = make([]SignedTrx, 0)
+	return orphaned
+}
+
+// genesisState returns the state preceding the first block.
+func (s *State) genesisState() State {
+	g := State{
+		balances:      make(map[common.Address]uint64),
+		accountNonces: make(map[common.Address]uint64),
+		chainID:       s.chainID,
+		genesisTime:   s.genesisTime,
+		params:        s.params,
+		store:         s.store,
+	}
+	maps.Copy(g.balances, s.genesisBalances)
+	g.stateTree = newStateTree(g.balances, g.accountNonces)
+
+	return g
+}
+
+// rewind rebuilds the state after the first blockCount stored blocks from
+// the newest snapshot below, or the genesis.
+func (s *State) rewind(blockCount uint64) (State, error) {
+	r := s.genesisState()
+
+	replayFrom := uint64(0)
+
+	if blockCount > 0 {
+		snapshot, ok, err := s.latestSnapshot(blockCount - 1)
+		if err != nil {
+			return State{}, err
+		}
+		if ok {
+			if err := r.restoreSnapshot(snapshot); err != nil {
+				return State{}, err
+			}
+			replayFrom = snapshot.Height + 1
+
+			fmt.Printf("Restored state snapshot at height %d (%s)\n", snapshot.Height, snapshot.Hash.Hex())
+		}
+	}
+
+	if replayFrom < s.store.Base() {
+		return State{}, NewBlockPruned(replayFrom, s.store.Base())
+	}
+
+	for height := replayFrom; height < blockCount; height++ {
+		blockFS, err := s.store.BlockByHeight(height)
+		if err != nil {
+			return State{}, err
+		}
+
+		if err := applyBlock(blockFS.Value, &r); err != nil {
+			return State{}, fmt.Errorf("block at height %d: %w", height, err)
+		}
+	}
+
+	return r, nil
+}
+
+func (s *State) pruneSideBlocks() {
+	if s.latestBlock.Header.Height < maxForkDepth {
+		return
+	}
+
+	for hash, side := range s.sideBlocks {
+		if side.block.Header.Height < s.latestBlock.Header.Height-maxForkDepth {
+			delete(s.sideBlocks, hash)
+		}
+	}
+}
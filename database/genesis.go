@@ -1,18 +1,28 @@
 package database
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 
 	"github.com/marc-watters/the-block-chain-bar/v2/fs"
 )
 
+// Genesis describes how a chain starts.
 type Genesis struct {
+	Time    time.Time `json:"genesis_time"`
+	ChainID string    `json:"chain_id"`
+	ChainParams
 	Balances map[common.Address]uint64 `json:"balances"`
 }
 
-func loadGenesis(path string) (Genesis, error) {
+// LoadGenesis reads a genesis file.
+func LoadGenesis(path string) (Genesis, error) {
 	content, err := fs.AppFS.ReadFile(path)
 	if err != nil {
 		return Genesis{}, err
@@ -21,8 +31,107 @@ func loadGenesis(path string) (Genesis, error) {
 	var loadedGenesis Genesis
 	err = json.Unmarshal(content, &loadedGenesis)
 	if err != nil {
-		return Genesis{}, err
+		return Genesis{}, fmt.Errorf("unable to read genesis '%s': %v", path, err)
 	}
 
 	return loadedGenesis, nil
 }
+
+// Validate checks the genesis names its chain and its start.
+func (g Genesis) Validate() error {
+	if g.ChainID == "" {
+		return fmt.Errorf("genesis has no chain id")
+	}
+	if g.Time.IsZero() {
+		return fmt.Errorf("genesis has no genesis time")
+	}
+
+	return g.check()
+}
+
+// check verifies the consensus parameters and allocated balances.
+func (g Genesis) check() error {
+	if err := g.ChainParams.validate(); err != nil {
+		return err
+	}
+
+	var total uint64
+	for account, balance := range g.Balances {
+		if account == (common.Address{}) {
+			return fmt.Errorf("genesis allocates to the zero address")
+		}
+		if balance > math.MaxUint64-total {
+			return fmt.Errorf("genesis allocations overflow a balance")
+		}
+		total += balance
+	}
+
+	return nil
+}
+
+// Encode returns the genesis file content.
+func (g Genesis) Encode() ([]byte, error) {
+	return json.MarshalIndent(g, "", "  ")
+}
+
+// timeNano returns the genesis time in nanoseconds.
+func (g Genesis) timeNano() uint64 {
+	if g.Time.Before(time.Unix(0, 0)) {
+		return 0
+	}
+	return uint64(g.Time.UnixNano())
+}
+
+// Genesis returns the genesis the state was loaded from.
+func (s *State) Genesis() Genesis {
+	g := s.genesis
+	g.Balances = maps.Clone(s.genesis.Balances)
+	return g
+}
+
+// InitDataDir bootstraps a data directory with the given genesis, unless
+// it already holds it.
+func InitDataDir(dataDir string, g Genesis) error {
+	dataDir = fs.ExpandPath(dataDir)
+
+	if err := g.Validate(); err != nil {
+		return fmt.Errorf("invalid genesis: %w", err)
+	}
+
+	content, err := g.Encode()
+	if err != nil {
+		return err
+	}
+
+	path := fs.GetGenesisJSONFilePath(dataDir)
+	if fs.FileExist(path) {
+		existing, err := LoadGenesis(path)
+		if err != nil {
+			return err
+		}
+		same, err := sameGenesis(existing, g)
+		if err != nil {
+			return err
+		}
+		if !same {
+			return fmt.Errorf("'%s' was initialized with another genesis", dataDir)
+		}
+		return nil
+	}
+
+	return fs.InitDataDirIfNotExists(dataDir, content)
+}
+
+// sameGenesis reports whether two genesis describe the same chain.
+func sameGenesis(a, b Genesis) (bool, error) {
+	aContent, err := a.Encode()
+	if err != nil {
+		return false, err
+	}
+	bContent, err := b.Encode()
+	if err != nil {
+		return false, err
+	}
+
+	return bytes.Equal(aContent, bContent), nil
+}
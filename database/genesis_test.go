@@ -0,0 +1,99 @@
+package database
+
+import (
+	"errors"
+	"math"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/marc-watters/the-block-chain-bar/v2/fs"
+)
+
+func TestGenesis_Validate(t *testing.T) {
+	andrej := common.HexToAddress("0x3eb92807f1f91a8d4d85bc908c7f86dcddb1df57")
+	babayaga := common.HexToAddress("0x6fdc0d8d15ae6b4ebf45c52fd2aafbcbb19a65c8")
+
+	valid := Genesis{
+		Time:        time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		ChainID:     "tbb-test",
+		ChainParams: ChainParams{Difficulty: 16, BlockTime: 30, RetargetInterval: 20},
+		Balances:    map[common.Address]uint64{andrej: 1000},
+	}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("expected a valid genesis, got: %v", err)
+	}
+
+	tests := map[string]func(g *Genesis){
+		"no chain id":        func(g *Genesis) { g.ChainID = "" },
+		"no genesis time":    func(g *Genesis) { g.Time = time.Time{} },
+		"retarget interval":  func(g *Genesis) { g.RetargetInterval = 1 },
+		"zero address":       func(g *Genesis) { g.Balances = map[common.Address]uint64{{}: 1} },
+		"overflowing supply": func(g *Genesis) { g.Balances = map[common.Address]uint64{andrej: math.MaxUint64, babayaga: 1} },
+	}
+	for name, invalidate := range tests {
+		t.Run(name, func(t *testing.T) {
+			g := valid
+			invalidate(&g)
+			if err := g.Validate(); err == nil {
+				t.Errorf("expected the genesis to be invalid")
+			}
+		})
+	}
+}
+
+func TestInitDataDir(t *testing.T) {
+	andrej := common.HexToAddress("0x3eb92807f1f91a8d4d85bc908c7f86dcddb1df57")
+	genesisTime := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+
+	g := Genesis{
+		Time:        genesisTime,
+		ChainID:     "tbb-custom",
+		ChainParams: ChainParams{Difficulty: 16, BlockTime: 30, RetargetInterval: 0},
+		Balances:    map[common.Address]uint64{andrej: 1000},
+	}
+
+	dataDir, err := fs.AppFS.TempDir(os.TempDir(), "tbb_genesis_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { fs.RemoveDir(dataDir) })
+
+	if err := InitDataDir(dataDir, g); err != nil {
+		t.Fatalf("error initializing data directory: %v", err)
+	}
+	if err := InitDataDir(dataDir, g); err != nil {
+		t.Errorf("initializing with the same genesis again should succeed, got: %v", err)
+	}
+
+	other := g
+	other.ChainID = "tbb-other"
+	if err := InitDataDir(dataDir, other); err == nil {
+		t.Errorf("expected initializing with another genesis to fail")
+	}
+
+	s, err := NewStateFromDisk(dataDir)
+	if err != nil {
+		t.Fatalf("error creating state: %v", err)
+	}
+	defer s.Close()
+
+	loaded := s.Genesis()
+	if !loaded.Time.Equal(genesisTime) || loaded.ChainID != g.ChainID || loaded.ChainParams != g.ChainParams || loaded.Balances[andrej] != 1000 {
+		t.Errorf("loaded genesis %+v doesn't match %+v", loaded, g)
+	}
+	if s.ChainID() != g.ChainID {
+		t.Errorf("chain id should be %s not %s", g.ChainID, s.ChainID())
+	}
+
+	balances := map[common.Address]uint64{andrej: 1000 + BlockReward}
+	beforeGenesis := mineTestBlockAt(t, Hash{}, 0, 16, uint64(genesisTime.UnixNano()), andrej, balances)
+	var tooOld ErrBlockTooOld
+	if _, err := s.AddBlock(beforeGenesis); !errors.As(err, &tooOld) {
+		t.Errorf("expected a block not after the genesis time to be rejected, got: %v", err)
+	}
+
+	addTestBlock(t, s, mineTestBlockAt(t, Hash{}, 0, 16, uint64(genesisTime.Add(time.Second).UnixNano()), andrej, balances))
+}
@@ -0,0 +1,251 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Kinds of balance changes recorded in an account history.
+const (
+	HistorySent     = "sent"
+	HistoryReceived = "received"
+	HistoryReward   = "reward"
+)
+
+type (
+	// HistoryEntry is one change to an account balance. Reward entries have no
+	// transaction nor counterparty.
+	HistoryEntry struct {
+		BlockHeight  uint64         `json:"block_height"`
+		BlockHash    Hash           `json:"block_hash"`
+		Kind         string         `json:"kind"`
+		TrxHash      Hash           `json:"trx_hash"`
+		Counterparty common.Address `json:"counterparty"`
+		Amount       uint64         `json:"amount"`
+		Fee          uint64         `json:"fee"`
+	}
+
+	// historyRange numbers the stored history entries of an account.
+	historyRange struct {
+		First uint64 `json:"first"`
+		Next  uint64 `json:"next"`
+	}
+)
+
+// indexHistory appends the history entries of a main chain block, first
+// dropping any left over by an interrupted rollback.
+func (s *State) indexHistory(blockFS BlockFS) error {
+	entries, err := blockHistory(blockFS)
+	if err != nil {
+		return err
+	}
+
+	for account, accountEntries := range entries {
+		r, err := s.truncateHistory(account, blockFS.Value.Header.Height)
+		if err != nil {
+			return err
+		}
+
+		for _, e := range accountEntries {
+			if err := s.putHistoryEntry(account, r.Next, e); err != nil {
+				return err
+			}
+			r.Next++
+		}
+
+		if err := s.putHistoryRange(account, r); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// unindexHistory drops the history entries of a block and its successors.
+func (s *State) unindexHistory(blockFS BlockFS) error {
+	entries, err := blockHistory(blockFS)
+	if err != nil {
+		return err
+	}
+
+	for account := range entries {
+		r, err := s.truncateHistory(account, blockFS.Value.Header.Height)
+		if err != nil {
+			return err
+		}
+		if err := s.putHistoryRange(account, r); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// pruneHistory drops the pruned block's entries below height base.
+func (s *State) pruneHistory(blockFS BlockFS, base uint64) error {
+	entries, err := blockHistory(blockFS)
+	if err != nil {
+		return err
+	}
+
+	for account := range entries {
+		r, err := s.historyRange(account)
+		if err != nil {
+			return err
+		}
+
+		for ; r.First < r.Next; r.First++ {
+			e, err := s.historyEntry(account, r.First)
+			if err != nil {
+				return err
+			}
+			if e.BlockHeight >= base {
+				break
+			}
+			if err := s.store.DeleteState(historyEntryKey(account, r.First)); err != nil {
+				return err
+			}
+		}
+
+		if err := s.putHistoryRange(account, r); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// truncateHistory deletes the account's entries from height onwards.
+func (s *State) truncateHistory(account common.Address, height uint64) (historyRange, error) {
+	r, err := s.historyRange(account)
+	if err != nil {
+		return historyRange{}, err
+	}
+
+	for ; r.Next > r.First; r.Next-- {
+		e, err := s.historyEntry(account, r.Next-1)
+		if err != nil {
+			return historyRange{}, err
+		}
+		if e.BlockHeight < height {
+			break
+		}
+		if err := s.store.DeleteState(historyEntryKey(account, r.Next-1)); err != nil {
+			return historyRange{}, err
+		}
+	}
+
+	return r, nil
+}
+
+// blockHistory lists the history entries of a block by account.
+func blockHistory(blockFS BlockFS) (map[common.Address][]HistoryEntry, error) {
+	entries := make(map[common.Address][]HistoryEntry)
+	height := blockFS.Value.Header.Height
+
+	for _, trx := range blockFS.Value.TRXs {
+		trxHash, err := trx.Hash()
+		if err != nil {
+			return nil, err
+		}
+
+		entries[trx.From] = append(entries[trx.From], HistoryEntry{height, blockFS.Key, HistorySent, trxHash, trx.To, trx.Value, trx.Fee})
+		entries[trx.To] = append(entries[trx.To], HistoryEntry{height, blockFS.Key, HistoryReceived, trxHash, trx.From, trx.Value, 0})
+	}
+
+	miner := blockFS.Value.Header.Miner
+	entries[miner] = append(entries[miner], HistoryEntry{height, blockFS.Key, HistoryReward, Hash{}, common.Address{}, blockFS.Value.Reward(), 0})
+
+	return entries, nil
+}
+
+// AccountHistory returns a page of the account's history, oldest first,
+// and the total number of entries.
+func (s *State) AccountHistory(account common.Address, offset, limit uint64) ([]HistoryEntry, uint64, error) {
+	r, err := s.historyRange(account)
+	if err != nil {
+		return nil, 0, err
+	}
+	total := r.Next - r.First
+
+	if offset >= total {
+		return make([]HistoryEntry, 0), total, nil
+	}
+
+	end := total
+	if limit < total-offset {
+		end = offset + limit
+	}
+
+	entries := make([]HistoryEntry, 0, end-offset)
+	for n := r.First + offset; n < r.First+end; n++ {
+		e, err := s.historyEntry(account, n)
+		if err != nil {
+			return nil, 0, err
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, total, nil
+}
+
+func (s *State) historyRange(account common.Address) (historyRange, error) {
+	rangeJSON, err := s.store.GetState(historyRangeKey(account))
+	var notFound ErrStateNotFound
+	if errors.As(err, &notFound) {
+		return historyRange{}, nil
+	}
+	if err != nil {
+		return historyRange{}, err
+	}
+
+	var r historyRange
+	if err := json.Unmarshal(rangeJSON, &r); err != nil {
+		return historyRange{}, err
+	}
+	return r, nil
+}
+
+func (s *State) putHistoryRange(account common.Address, r historyRange) error {
+	if r.First == r.Next {
+		return s.store.DeleteState(historyRangeKey(account))
+	}
+
+	rangeJSON, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return s.store.PutState(historyRangeKey(account), rangeJSON)
+}
+
+func (s *State) historyEntry(account common.Address, n uint64) (HistoryEntry, error) {
+	entryJSON, err := s.store.GetState(historyEntryKey(account, n))
+	if err != nil {
+		return HistoryEntry{}, err
+	}
+
+	var e HistoryEntry
+	if err := json.Unmarshal(entryJSON, &e); err != nil {
+		return HistoryEntry{}, err
+	}
+	return e, nil
+}
+
+func (s *State) putHistoryEntry(account common.Address, n uint64, e HistoryEntry) error {
+	entryJSON, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return s.store.PutState(historyEntryKey(account, n), entryJSON)
+}
+
+func historyRangeKey(account common.Address) string {
+	return fmt.Sprintf("history-%x", account)
+}
+
+func historyEntryKey(account common.Address, n uint64) string {
+	return fmt.Sprintf("history-%x-%d", account, n)
+}
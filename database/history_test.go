@@ -0,0 +1,82 @@
+package database
+
+import (
+	"math"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestAccountHistory(t *testing.T) {
+	privKey, from := generateTestKey(t)
+	to := common.HexToAddress("0x6fdc0d8d15ae6b4ebf45c52fd2aafbcbb19a65c8")
+	miner := common.HexToAddress("0x3eb92807f1f91a8d4d85bc908c7f86dcddb1df57")
+
+	store, err := openStorage(setupTestDataDir(t), options{engine: EngineFile})
+	if err != nil {
+		t.Fatalf("error opening storage: %v", err)
+	}
+	s := &State{store: store}
+	defer s.Close()
+
+	blocks := make([]BlockFS, 0)
+	for height := uint64(0); height < 3; height++ {
+		trx := signTestTrx(t, privKey, NewTrx(from, to, 10, 2, height+1, ""))
+		b := NewBlock(Hash{byte(height)}, height, 1, 0, 0, miner, Hash{}, []SignedTrx{trx})
+		blocks = append(blocks, BlockFS{Hash{byte(height + 1)}, b})
+		if err := s.indexHistory(blocks[height]); err != nil {
+			t.Fatalf("error indexing block: %v", err)
+		}
+	}
+
+	entries, total, err := s.AccountHistory(from, 1, 10)
+	if err != nil {
+		t.Fatalf("error reading history: %v", err)
+	}
+	if total != 3 || len(entries) != 2 {
+		t.Fatalf("expected 2 of 3 entries, got %d of %d", len(entries), total)
+	}
+	if e := entries[0]; e.Kind != HistorySent || e.BlockHeight != 1 || e.Counterparty != to || e.Amount != 10 || e.Fee != 2 {
+		t.Errorf("unexpected sent entry: %+v", e)
+	}
+
+	entries, _, _ = s.AccountHistory(from, 1, math.MaxUint64)
+	if len(entries) != 2 || entries[0].BlockHeight != 1 {
+		t.Errorf("a limit overflowing the offset should return the remaining entries, got %+v", entries)
+	}
+
+	entries, _, _ = s.AccountHistory(to, 0, 1)
+	if len(entries) != 1 || entries[0].Kind != HistoryReceived || entries[0].Counterparty != from {
+		t.Errorf("unexpected received entries: %+v", entries)
+	}
+
+	entries, _, _ = s.AccountHistory(miner, 0, 10)
+	if len(entries) != 3 || entries[0].Kind != HistoryReward || entries[0].Amount != BlockReward+2 {
+		t.Errorf("unexpected reward entries: %+v", entries)
+	}
+
+	if err := s.unindexHistory(blocks[1]); err != nil {
+		t.Fatalf("error unindexing blocks: %v", err)
+	}
+	if _, total, _ := s.AccountHistory(from, 0, 10); total != 1 {
+		t.Errorf("only the entry of the first block should remain, got %d", total)
+	}
+	if entries, total, _ := s.AccountHistory(from, 5, 10); total != 1 || len(entries) != 0 {
+		t.Errorf("an offset past the end should return no entries, got %d of %d", len(entries), total)
+	}
+
+	// Indexing a block again replaces the entries left over from it.
+	if err := s.indexHistory(blocks[0]); err != nil {
+		t.Fatalf("error indexing block: %v", err)
+	}
+	if _, total, _ := s.AccountHistory(miner, 0, 10); total != 1 {
+		t.Errorf("the reward of the first block should be listed once, got %d entries", total)
+	}
+
+	if err := s.pruneHistory(blocks[0], 1); err != nil {
+		t.Fatalf("error pruning history: %v", err)
+	}
+	if _, total, _ := s.AccountHistory(to, 0, 10); total != 0 {
+		t.Errorf("the entries of pruned blocks should be dropped, %d remain", total)
+	}
+}
@@ -0,0 +1,315 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/marc-watters/the-block-chain-bar/v2/fs"
+)
+
+// legacyRewardData marks the v1 reward transactions.
+const legacyRewardData = "reward"
+
+type (
+	// LegacyMigration configures MigrateLegacyDataDir. Without Sign the v1
+	// history is collapsed into the genesis balances, with it the v1 blocks are
+	// signed and mined again by Miner.
+	LegacyMigration struct {
+		Accounts map[string]common.Address
+		Params   ChainParams
+		Miner    common.Address
+		Sign     func(trx Trx, chainID string) (SignedTrx, error)
+		DryRun   bool
+	}
+
+	// LegacyReport describes a v1 data directory and what it converts to.
+	LegacyReport struct {
+		Blocks    int
+		Transfers int
+		Rewards   int
+		Skipped   int
+		Replayed  bool
+		Genesis   Genesis
+		Balances  map[common.Address]uint64
+		LegacyDir string
+	}
+
+	legacyGenesis struct {
+		Time     time.Time         `json:"genesis_time"`
+		ChainID  string            `json:"chain_id"`
+		Balances map[string]uint64 `json:"balances"`
+	}
+
+	legacyBlockFS struct {
+		Key   Hash        `json:"hash"`
+		Value legacyBlock `json:"block"`
+	}
+
+	legacyBlock struct {
+		Header struct {
+			Parent Hash   `json:"parent"`
+			Time   uint64 `json:"time"`
+		} `json:"header"`
+		TRXs []legacyTrx `json:"payload"`
+	}
+
+	legacyTrx struct {
+		From  string `json:"from"`
+		To    string `json:"to"`
+		Value uint64 `json:"value"`
+		Data  string `json:"data"`
+	}
+)
+
+// IsLegacyDataDir reports whether the genesis names its accounts as v1 did.
+func IsLegacyDataDir(dataDir string) bool {
+	g, err := loadLegacyGenesis(fs.GetGenesisJSONFilePath(fs.ExpandPath(dataDir)))
+	if err != nil {
+		return false
+	}
+
+	for name := range g.Balances {
+		if !common.IsHexAddress(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// MigrateLegacyDataDir converts a v1 data directory to the current format,
+// keeping the v1 database next to the new one.
+func MigrateLegacyDataDir(dataDir string, m LegacyMigration) (LegacyReport, error) {
+	dataDir = fs.ExpandPath(dataDir)
+	dbDir := fs.GetDatabaseDirPath(dataDir)
+	report := LegacyReport{Replayed: m.Sign != nil, LegacyDir: dbDir + ".v1"}
+
+	if !IsLegacyDataDir(dataDir) {
+		return report, fmt.Errorf("'%s' doesn't hold a legacy v1 database", dataDir)
+	}
+	if fs.FileExist(report.LegacyDir) {
+		return report, fmt.Errorf("'%s' already exists", report.LegacyDir)
+	}
+
+	lg, err := loadLegacyGenesis(fs.GetGenesisJSONFilePath(dataDir))
+	if err != nil {
+		return report, err
+	}
+	blocks, err := loadLegacyBlocks(fs.GetBlocksDBFilePath(dataDir))
+	if err != nil {
+		return report, err
+	}
+
+	if err := checkLegacyAccounts(lg, blocks, m.Accounts); err != nil {
+		return report, err
+	}
+	if report.Replayed && m.Miner == (common.Address{}) {
+		return report, fmt.Errorf("replaying the v1 blocks needs a miner")
+	}
+
+	balances := make(map[common.Address]uint64)
+	rewards := make(map[common.Address]uint64)
+	for name, balance := range lg.Balances {
+		balances[m.Accounts[name]] += balance
+	}
+	for i, b := range blocks {
+		for _, trx := range b.Value.TRXs {
+			from, to := m.Accounts[trx.From], m.Accounts[trx.To]
+
+			switch {
+			case trx.Data == legacyRewardData:
+				report.Rewards++
+				rewards[to] += trx.Value
+				balances[to] += trx.Value
+			case trx.Value == 0:
+				report.Skipped++
+			case trx.Value > balances[from]:
+				return report, fmt.Errorf("v1 block %d transfers %d from '%s' holding %d", i, trx.Value, trx.From, balances[from])
+			default:
+				report.Transfers++
+				balances[from] -= trx.Value
+				balances[to] += trx.Value
+			}
+		}
+	}
+	report.Blocks = len(blocks)
+
+	report.Genesis = Genesis{
+		Time:        lg.Time,
+		ChainID:     lg.ChainID,
+		ChainParams: m.Params.withDefaults(),
+		Balances:    maps.Clone(balances),
+	}
+	report.Balances = balances
+	if report.Replayed {
+		report.Genesis.Balances = make(map[common.Address]uint64)
+		for name, balance := range lg.Balances {
+			report.Genesis.Balances[m.Accounts[name]] += balance
+		}
+		for account, reward := range rewards {
+			report.Genesis.Balances[account] += reward
+		}
+		report.Balances[m.Miner] += uint64(len(blocks)) * BlockReward
+	}
+
+	if err := report.Genesis.Validate(); err != nil {
+		return report, fmt.Errorf("invalid genesis: %w", err)
+	}
+
+	if m.DryRun {
+		return report, nil
+	}
+
+	stagingDir := filepath.Join(dataDir, "migrate.tmp")
+	if err := fs.RemoveDir(stagingDir); err != nil {
+		return report, err
+	}
+	defer fs.RemoveDir(stagingDir)
+
+	if err := InitDataDir(stagingDir, report.Genesis); err != nil {
+		return report, err
+	}
+
+	if report.Replayed {
+		if err := replayLegacyBlocks(stagingDir, blocks, m); err != nil {
+			return report, err
+		}
+	}
+
+	if err := fs.AppFS.Rename(dbDir, report.LegacyDir); err != nil {
+		return report, err
+	}
+	if err := fs.AppFS.Rename(fs.GetDatabaseDirPath(stagingDir), dbDir); err != nil {
+		return report, err
+	}
+
+	return report, nil
+}
+
+// replayLegacyBlocks mines a block for every v1 block into the staging
+// data directory.
+func replayLegacyBlocks(stagingDir string, blocks []legacyBlockFS, m LegacyMigration) error {
+	s, err := NewStateFromDisk(stagingDir, WithSyncPolicy(SyncNever))
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	for i, legacy := range blocks {
+		// v1 timestamps are in seconds and may repeat, which median time past rejects.
+		blockTime := legacy.Value.Header.Time * uint64(time.Second)
+		if mtp := s.MedianTimePast(); blockTime <= mtp {
+			blockTime = mtp + 1
+		}
+
+		trxs := make([]SignedTrx, 0, len(legacy.Value.TRXs))
+		for _, trx := range legacy.Value.TRXs {
+			if trx.Data == legacyRewardData || trx.Value == 0 {
+				continue
+			}
+
+			from := m.Accounts[trx.From]
+			nonce := s.GetNextAccountNonce(from)
+			for _, pending := range trxs {
+				if pending.From == from {
+					nonce++
+				}
+			}
+
+			signed, err := m.Sign(Trx{from, m.Accounts[trx.To], trx.Value, 0, nonce, trx.Data, blockTime}, s.ChainID())
+			if err != nil {
+				return fmt.Errorf("signing transfer of v1 block %d: %w", i, err)
+			}
+			trxs = append(trxs, signed)
+		}
+
+		stateRoot, err := s.PendingStateRoot(m.Miner, trxs)
+		if err != nil {
+			return fmt.Errorf("replaying v1 block %d: %w", i, err)
+		}
+
+		b := NewBlock(s.LatestBlockHash(), s.NextBlockHeight(), s.NextBlockDifficulty(), 0, blockTime, m.Miner, stateRoot, trxs)
+		if _, err := b.seal(); err != nil {
+			return err
+		}
+		if _, err := s.AddBlock(b); err != nil {
+			return fmt.Errorf("replaying v1 block %d: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// checkLegacyAccounts checks every v1 account name is mapped to an address.
+func checkLegacyAccounts(g legacyGenesis, blocks []legacyBlockFS, accounts map[string]common.Address) error {
+	unmapped := make(map[string]struct{})
+	check := func(name string) {
+		if account, ok := accounts[name]; !ok || account == (common.Address{}) {
+			unmapped[name] = struct{}{}
+		}
+	}
+
+	for name := range g.Balances {
+		check(name)
+	}
+	for _, b := range blocks {
+		for _, trx := range b.Value.TRXs {
+			check(trx.From)
+			check(trx.To)
+		}
+	}
+
+	if len(unmapped) > 0 {
+		return fmt.Errorf("no address mapped to the v1 accounts %q", slices.Sorted(maps.Keys(unmapped)))
+	}
+	return nil
+}
+
+func loadLegacyGenesis(path string) (legacyGenesis, error) {
+	content, err := fs.AppFS.ReadFile(path)
+	if err != nil {
+		return legacyGenesis{}, err
+	}
+
+	var g legacyGenesis
+	if err := json.Unmarshal(content, &g); err != nil {
+		return legacyGenesis{}, fmt.Errorf("unable to read genesis '%s': %v", path, err)
+	}
+
+	return g, nil
+}
+
+// loadLegacyBlocks reads a v1 block.db, checking the blocks link up.
+func loadLegacyBlocks(path string) ([]legacyBlockFS, error) {
+	content, err := fs.AppFS.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := decodeJSONLines(content)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read '%s': %w", path, err)
+	}
+
+	blocks := make([]legacyBlockFS, 0, len(records))
+	var parent Hash
+	for i, record := range records {
+		var b legacyBlockFS
+		if err := json.Unmarshal(record, &b); err != nil {
+			return nil, fmt.Errorf("unable to read v1 block %d: %v", i, err)
+		}
+		if b.Value.Header.Parent != parent {
+			return nil, fmt.Errorf("v1 block %d isn't linked to block %d", i, i-1)
+		}
+
+		blocks = append(blocks, b)
+		parent = b.Key
+	}
+
+	return blocks, nil
+}
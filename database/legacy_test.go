@@ -0,0 +1,170 @@
+package database
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/marc-watters/the-block-chain-bar/v2/fs"
+)
+
+// The v1 blocks share a timestamp and mix transfers with minted rewards.
+const (
+	testLegacyGenesisJSON = `{
+  "genesis_time": "2019-03-18T00:00:00.000000000Z",
+  "chain_id": "the-blockchain-bar-ledger",
+  "balances": {"andrej": 1000}
+}`
+	testLegacyBlocksDB = `{"hash":"08f20545c5f35b0a2127c06f349312b6c616c421c7d71cb879e70baab388e332","block":{"header":{"parent":"0000000000000000000000000000000000000000000000000000000000000000","time":1741279233},"payload":[{"From":"andrej","To":"babayaga","Value":300,"Data":""},{"From":"andrej","To":"andrej","Value":700,"Data":"reward"}]}}
+{"hash":"162b412c1572774713ec85a69a1202f73b9d0b5738d631200825c6b39b9a41cc","block":{"header":{"parent":"08f20545c5f35b0a2127c06f349312b6c616c421c7d71cb879e70baab388e332","time":1741279233},"payload":[{"From":"babayaga","To":"caesar","Value":100,"Data":""},{"From":"babayaga","To":"andrej","Value":50,"Data":""},{"From":"andrej","To":"caesar","Value":0,"Data":""}]}}
+`
+)
+
+func TestMigrateLegacyDataDir(t *testing.T) {
+	keys := make(map[common.Address]*ecdsa.PrivateKey)
+	accounts := make(map[string]common.Address)
+	for _, name := range []string{"andrej", "babayaga", "caesar"} {
+		privKey, account := generateTestKey(t)
+		keys[account] = privKey
+		accounts[name] = account
+	}
+	andrej, babayaga, caesar := accounts["andrej"], accounts["babayaga"], accounts["caesar"]
+	miner := common.HexToAddress("0x22ba1F80452E6220c7cc6ea2D1e3EEDDaC5F694A")
+
+	sign := func(trx Trx, chainID string) (SignedTrx, error) {
+		trxHash, err := trx.SigningHash(chainID)
+		if err != nil {
+			return SignedTrx{}, err
+		}
+		sig, err := crypto.Sign(trxHash[:], keys[trx.From])
+		if err != nil {
+			return SignedTrx{}, err
+		}
+		return NewSignedTrx(trx, sig), nil
+	}
+
+	setupLegacyDataDir := func(t *testing.T) string {
+		t.Helper()
+
+		dataDir, err := fs.AppFS.TempDir(os.TempDir(), "tbb_legacy_test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { fs.RemoveDir(dataDir) })
+
+		if err := fs.AppFS.MkdirAll(fs.GetDatabaseDirPath(dataDir), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := fs.AppFS.WriteFile(fs.GetGenesisJSONFilePath(dataDir), []byte(testLegacyGenesisJSON), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := fs.AppFS.WriteFile(fs.GetBlocksDBFilePath(dataDir), []byte(testLegacyBlocksDB), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		return dataDir
+	}
+
+	params := ChainParams{Difficulty: 16, RetargetInterval: 0}
+
+	t.Run("rejects unmapped accounts", func(t *testing.T) {
+		dataDir := setupLegacyDataDir(t)
+
+		var legacy ErrLegacyDataDir
+		if _, err := NewStateFromDisk(dataDir); !errors.As(err, &legacy) {
+			t.Fatalf("expected a legacy data directory error, got: %v", err)
+		}
+
+		_, err := MigrateLegacyDataDir(dataDir, LegacyMigration{
+			Accounts: map[string]common.Address{"andrej": andrej, "babayaga": babayaga},
+			Params:   params,
+		})
+		if err == nil {
+			t.Errorf("expected migrating without mapping caesar to fail")
+		}
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		dataDir := setupLegacyDataDir(t)
+
+		report, err := MigrateLegacyDataDir(dataDir, LegacyMigration{Accounts: accounts, Params: params, DryRun: true})
+		if err != nil {
+			t.Fatalf("error reporting migration: %v", err)
+		}
+		if report.Blocks != 2 || report.Transfers != 3 || report.Rewards != 1 || report.Skipped != 1 {
+			t.Errorf("unexpected report %+v", report)
+		}
+		if fs.FileExist(report.LegacyDir) || !IsLegacyDataDir(dataDir) {
+			t.Errorf("a dry run shouldn't convert the data directory")
+		}
+	})
+
+	t.Run("collapse", func(t *testing.T) {
+		dataDir := setupLegacyDataDir(t)
+
+		if _, err := MigrateLegacyDataDir(dataDir, LegacyMigration{Accounts: accounts, Params: params}); err != nil {
+			t.Fatalf("error migrating: %v", err)
+		}
+
+		s, err := NewStateFromDisk(dataDir)
+		if err != nil {
+			t.Fatalf("error loading migrated state: %v", err)
+		}
+		defer s.Close()
+
+		if s.hasGenesisBlock {
+			t.Errorf("the collapsed chain shouldn't hold blocks")
+		}
+		want := map[common.Address]uint64{andrej: 1450, babayaga: 150, caesar: 100}
+		for account, balance := range want {
+			if s.Balances()[account] != balance {
+				t.Errorf("balance of %s should be %d not %d", account.Hex(), balance, s.Balances()[account])
+			}
+		}
+		if s.ChainID() != "the-blockchain-bar-ledger" {
+			t.Errorf("the v1 chain id should be kept, got %s", s.ChainID())
+		}
+		if !fs.FileExist(filepath.Join(dataDir, fs.Dir+".v1", fs.TrxFile)) {
+			t.Errorf("the v1 database should be kept")
+		}
+	})
+
+	t.Run("replay", func(t *testing.T) {
+		dataDir := setupLegacyDataDir(t)
+
+		m := LegacyMigration{Accounts: accounts, Params: params, Miner: miner, Sign: sign}
+		report, err := MigrateLegacyDataDir(dataDir, m)
+		if err != nil {
+			t.Fatalf("error migrating: %v", err)
+		}
+
+		s, err := NewStateFromDisk(dataDir)
+		if err != nil {
+			t.Fatalf("error loading migrated state: %v", err)
+		}
+		defer s.Close()
+
+		if s.LatestBlock().Header.Height != 1 {
+			t.Errorf("latest block should be at height 1 not %d", s.LatestBlock().Header.Height)
+		}
+		if s.Genesis().Balances[andrej] != 1700 {
+			t.Errorf("the v1 reward should be credited in the genesis, got %d", s.Genesis().Balances[andrej])
+		}
+		for account, balance := range report.Balances {
+			if s.Balances()[account] != balance {
+				t.Errorf("balance of %s should be %d not %d", account.Hex(), balance, s.Balances()[account])
+			}
+		}
+		if s.Balances()[miner] != 2*BlockReward {
+			t.Errorf("the miner should earn the rewards of the replayed blocks, got %d", s.Balances()[miner])
+		}
+		if s.GetNextAccountNonce(babayaga) != 3 {
+			t.Errorf("babayaga should have sent 2 transactions, next nonce is %d", s.GetNextAccountNonce(babayaga))
+		}
+	})
+}
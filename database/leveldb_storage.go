@@ -0,0 +1,231 @@
+package database
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+
+	"github.com/marc-watters/the-block-chain-bar/v2/fs"
+)
+
+// Key prefixes of the records kept in the LevelDB database:
+//
+//	b<height> -> BlockFS in its binary encoding
+//	h<hash>   -> height
+//	s<key>    -> state value
+//	n         -> number of stored blocks
+//	p         -> height of the first stored block
+var (
+	levelDBBlockPrefix  = []byte("b")
+	levelDBHeightPrefix = []byte("h")
+	levelDBStatePrefix  = []byte("s")
+	levelDBLenKey       = []byte("n")
+	levelDBBaseKey      = []byte("p")
+)
+
+// levelDBStorage writes every block append as one LevelDB batch.
+type levelDBStorage struct {
+	db    *leveldb.DB
+	base  uint64
+	len   uint64
+	write *opt.WriteOptions
+}
+
+func openLevelDBStorage(dataDir string, sync bool, readOnly bool) (*levelDBStorage, error) {
+	db, err := leveldb.OpenFile(fs.GetLevelDBDirPath(dataDir), &opt.Options{ReadOnly: readOnly})
+	if err != nil {
+		return nil, err
+	}
+
+	s := &levelDBStorage{db: db, base: 0, len: 0, write: &opt.WriteOptions{Sync: sync}}
+
+	if s.len, err = getLevelDBHeight(db, levelDBLenKey); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	if s.base, err = getLevelDBHeight(db, levelDBBaseKey); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// getLevelDBHeight reads the height stored under key, zero if there's none.
+func getLevelDBHeight(db *leveldb.DB, key []byte) (uint64, error) {
+	heightBytes, err := db.Get(key, nil)
+	if err == leveldb.ErrNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(heightBytes), nil
+}
+
+func (s *levelDBStorage) AppendBlock(blockFS BlockFS) error {
+	height := blockFS.Value.Header.Height
+	if height != s.len {
+		return fmt.Errorf("next stored block height must be '%d' not '%d'", s.len, height)
+	}
+
+	record, err := blockFS.Encode()
+	if err != nil {
+		return err
+	}
+
+	batch := new(leveldb.Batch)
+	batch.Put(levelDBBlockKey(height), record)
+	batch.Put(levelDBHeightKey(blockFS.Key), encodeHeight(height))
+	batch.Put(levelDBLenKey, encodeHeight(height+1))
+
+	if err := s.db.Write(batch, s.write); err != nil {
+		return err
+	}
+
+	s.len = height + 1
+
+	return nil
+}
+
+func (s *levelDBStorage) BlockByHeight(height uint64) (BlockFS, error) {
+	if height < s.base {
+		return BlockFS{}, NewBlockPruned(height, s.base)
+	}
+
+	record, err := s.db.Get(levelDBBlockKey(height), nil)
+	if err == leveldb.ErrNotFound {
+		return BlockFS{}, NewBlockNotFound(fmt.Sprintf("%d", height))
+	}
+	if err != nil {
+		return BlockFS{}, err
+	}
+
+	return DecodeBlockFS(record)
+}
+
+func (s *levelDBStorage) BlockHeight(hash Hash) (uint64, bool) {
+	heightBytes, err := s.db.Get(levelDBHeightKey(hash), nil)
+	if err != nil {
+		return 0, false
+	}
+	return binary.BigEndian.Uint64(heightBytes), true
+}
+
+func (s *levelDBStorage) Len() uint64 {
+	return s.len
+}
+
+func (s *levelDBStorage) Base() uint64 {
+	return s.base
+}
+
+func (s *levelDBStorage) Truncate(length uint64) error {
+	if length < s.base {
+		return NewBlockPruned(length, s.base)
+	}
+	if length >= s.len {
+		return nil
+	}
+
+	batch := new(leveldb.Batch)
+	for height := length; height < s.len; height++ {
+		blockFS, err := s.BlockByHeight(height)
+		if err != nil {
+			return err
+		}
+		batch.Delete(levelDBBlockKey(height))
+		batch.Delete(levelDBHeightKey(blockFS.Key))
+	}
+	batch.Put(levelDBLenKey, encodeHeight(length))
+
+	if err := s.db.Write(batch, s.write); err != nil {
+		return err
+	}
+
+	s.len = length
+
+	return nil
+}
+
+// Prune drops every stored block below base.
+func (s *levelDBStorage) Prune(base uint64) (uint64, error) {
+	base = min(base, s.len)
+	if base <= s.base {
+		return s.base, nil
+	}
+
+	batch := new(leveldb.Batch)
+	for height := s.base; height < base; height++ {
+		blockFS, err := s.BlockByHeight(height)
+		if err != nil {
+			return s.base, err
+		}
+		batch.Delete(levelDBBlockKey(height))
+		batch.Delete(levelDBHeightKey(blockFS.Key))
+	}
+	batch.Put(levelDBBaseKey, encodeHeight(base))
+
+	if err := s.db.Write(batch, s.write); err != nil {
+		return s.base, err
+	}
+
+	s.base = base
+
+	return base, nil
+}
+
+func (s *levelDBStorage) PutState(key string, value []byte) error {
+	return s.db.Put(levelDBStateKey(key), value, s.write)
+}
+
+func (s *levelDBStorage) GetState(key string) ([]byte, error) {
+	value, err := s.db.Get(levelDBStateKey(key), nil)
+	if err == leveldb.ErrNotFound {
+		return nil, NewStateNotFound(key)
+	}
+	return value, err
+}
+
+func (s *levelDBStorage) DeleteState(key string) error {
+	return s.db.Delete(levelDBStateKey(key), s.write)
+}
+
+// Recovered never reports a recovery, LevelDB drops incomplete batches.
+func (s *levelDBStorage) Recovered() (Recovery, bool) {
+	return Recovery{}, false
+}
+
+// Damaged never reports damage as blocks are only read when asked for.
+func (s *levelDBStorage) Damaged() (Damage, bool) {
+	return Damage{}, false
+}
+
+func (s *levelDBStorage) Close() error {
+	return s.db.Close()
+}
+
+func levelDBBlockKey(height uint64) []byte {
+	return prefixKey(levelDBBlockPrefix, encodeHeight(height))
+}
+
+func levelDBHeightKey(hash Hash) []byte {
+	return prefixKey(levelDBHeightPrefix, hash[:])
+}
+
+func levelDBStateKey(key string) []byte {
+	return prefixKey(levelDBStatePrefix, []byte(key))
+}
+
+func prefixKey(prefix []byte, key []byte) []byte {
+	return append(append(make([]byte, 0, len(prefix)+len(key)), prefix...), key...)
+}
+
+func encodeHeight(height uint64) []byte {
+	heightBytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(heightBytes, height)
+	return heightBytes
+}
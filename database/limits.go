@@ -0,0 +1,61 @@
+package database
+
+import (
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// Consensus size limits of a block and a transaction.
+const (
+	MaxBlockTRXs  = 1000
+	MaxBlockSize  = 1 << 20
+	MaxTrxDataLen = 1024
+)
+
+// Size is the length of the block in its binary encoding.
+func (b Block) Size() (int, error) {
+	blockRLP, err := rlp.EncodeToBytes(b)
+	if err != nil {
+		return 0, err
+	}
+	return len(blockRLP), nil
+}
+
+// Size is the length the transaction adds to a block's binary encoding.
+func (st SignedTrx) Size() (int, error) {
+	trxRLP, err := rlp.EncodeToBytes(st)
+	if err != nil {
+		return 0, err
+	}
+	return len(trxRLP), nil
+}
+
+// checkLimits rejects blocks exceeding the consensus size limits.
+func (b Block) checkLimits() error {
+	if len(b.TRXs) > MaxBlockTRXs {
+		return NewTooManyTRXs(len(b.TRXs), MaxBlockTRXs)
+	}
+
+	for _, trx := range b.TRXs {
+		if err := trx.CheckLimits(); err != nil {
+			return err
+		}
+	}
+
+	size, err := b.Size()
+	if err != nil {
+		return err
+	}
+	if size > MaxBlockSize {
+		return NewBlockTooLarge(size, MaxBlockSize)
+	}
+
+	return nil
+}
+
+// CheckLimits rejects transactions exceeding the consensus size limits.
+func (t Trx) CheckLimits() error {
+	if len(t.Data) > MaxTrxDataLen {
+		return NewTrxDataTooLong(len(t.Data), MaxTrxDataLen)
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package database
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestBlock_CheckLimits(t *testing.T) {
+	trx := func(data string) SignedTrx {
+		return SignedTrx{Trx: Trx{Value: 1, Data: data}}
+	}
+
+	var tooManyTRXs ErrTooManyTRXs
+	b := Block{TRXs: make([]SignedTrx, MaxBlockTRXs+1)}
+	if err := b.checkLimits(); !errors.As(err, &tooManyTRXs) {
+		t.Errorf("expected block with too many transactions to be rejected, got: %v", err)
+	}
+
+	var dataTooLong ErrTrxDataTooLong
+	b = Block{TRXs: []SignedTrx{trx(strings.Repeat("a", MaxTrxDataLen+1))}}
+	if err := b.checkLimits(); !errors.As(err, &dataTooLong) {
+		t.Errorf("expected transaction with too much data to be rejected, got: %v", err)
+	}
+
+	var tooLarge ErrBlockTooLarge
+	b = Block{TRXs: make([]SignedTrx, MaxBlockTRXs)}
+	for i := range b.TRXs {
+		b.TRXs[i] = trx(strings.Repeat("a", MaxTrxDataLen))
+	}
+	if err := b.checkLimits(); !errors.As(err, &tooLarge) {
+		t.Errorf("expected block exceeding the maximum size to be rejected, got: %v", err)
+	}
+
+	b.TRXs = b.TRXs[:MaxBlockTRXs/2]
+	if err := b.checkLimits(); err != nil {
+		t.Errorf("block within limits should be accepted, got: %v", err)
+	}
+}
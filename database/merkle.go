@@ -0,0 +1,103 @@
+package database
+
+import (
+	"crypto/sha256"
+)
+
+// Domain prefixes so an inner node can't be passed off as a leaf.
+const (
+	merkleLeafPrefix = 0x00
+	merkleNodePrefix = 0x01
+)
+
+type (
+	// MerkleProof lists the sibling hashes from Leaf up to the root.
+	MerkleProof struct {
+		Leaf Hash         `json:"leaf"`
+		Path []MerkleNode `json:"path"`
+	}
+	// MerkleNode is a sibling on a proof path.
+	MerkleNode struct {
+		Hash Hash `json:"hash"`
+		Left bool `json:"left"`
+	}
+)
+
+// MerkleRoot computes the root of a binary Merkle tree over the leaves,
+// promoting an odd node to the next level unchanged.
+func MerkleRoot(leaves []Hash) Hash {
+	if len(leaves) == 0 {
+		return Hash{}
+	}
+
+	level := merkleLeaves(leaves)
+	for len(level) > 1 {
+		level = merkleLevelUp(level)
+	}
+
+	return level[0]
+}
+
+// NewMerkleProof builds the inclusion proof of the leaf at index.
+func NewMerkleProof(leaves []Hash, index int) MerkleProof {
+	proof := MerkleProof{Leaf: leaves[index], Path: make([]MerkleNode, 0)}
+
+	level := merkleLeaves(leaves)
+	for len(level) > 1 {
+		sibling := index ^ 1
+		if sibling < len(level) {
+			proof.Path = append(proof.Path, MerkleNode{level[sibling], sibling < index})
+		}
+
+		level = merkleLevelUp(level)
+		index /= 2
+	}
+
+	return proof
+}
+
+// VerifyMerkleProof reports whether the proof leads from its leaf to root.
+func VerifyMerkleProof(root Hash, proof MerkleProof) bool {
+	hash := merkleLeafHash(proof.Leaf)
+	for _, node := range proof.Path {
+		if node.Left {
+			hash = merkleNodeHash(node.Hash, hash)
+		} else {
+			hash = merkleNodeHash(hash, node.Hash)
+		}
+	}
+
+	return hash == root
+}
+
+func merkleLeaves(leaves []Hash) []Hash {
+	level := make([]Hash, len(leaves))
+	for i, leaf := range leaves {
+		level[i] = merkleLeafHash(leaf)
+	}
+	return level
+}
+
+func merkleLevelUp(level []Hash) []Hash {
+	next := make([]Hash, 0, (len(level)+1)/2)
+	for i := 0; i < len(level); i += 2 {
+		if i+1 == len(level) {
+			next = append(next, level[i])
+			continue
+		}
+		next = append(next, merkleNodeHash(level[i], level[i+1]))
+	}
+	return next
+}
+
+func merkleLeafHash(leaf Hash) Hash {
+	return sha256.Sum256(append([]byte{merkleLeafPrefix}, leaf[:]...))
+}
+
+func merkleNodeHash(left, right Hash) Hash {
+	data := make([]byte, 0, 1+2*len(left))
+	data = append(data, merkleNodePrefix)
+	data = append(data, left[:]...)
+	data = append(data, right[:]...)
+	return sha256.Sum256(data)
+}
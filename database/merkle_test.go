@@ -0,0 +1,68 @@
+package database
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestMerkleProof(t *testing.T) {
+	for count := 1; count <= 7; count++ {
+		leaves := make([]Hash, count)
+		for i := range leaves {
+			leaves[i] = Hash{byte(i + 1)}
+		}
+		root := MerkleRoot(leaves)
+
+		for i := range leaves {
+			proof := NewMerkleProof(leaves, i)
+			if !VerifyMerkleProof(root, proof) {
+				t.Errorf("proof of leaf %d of %d should verify", i, count)
+			}
+
+			proof.Leaf = Hash{0xff}
+			if VerifyMerkleProof(root, proof) {
+				t.Errorf("proof of leaf %d of %d should not verify for another leaf", i, count)
+			}
+		}
+	}
+
+	if !MerkleRoot(nil).IsEmpty() {
+		t.Errorf("root of no leaves should be the empty hash")
+	}
+}
+
+func TestBlock_TrxProof(t *testing.T) {
+	privKey, from := generateTestKey(t)
+	to := common.HexToAddress("0x6fdc0d8d15ae6b4ebf45c52fd2aafbcbb19a65c8")
+
+	trxs := make([]SignedTrx, 3)
+	for i := range trxs {
+		trxs[i] = signTestTrx(t, privKey, NewTrx(from, to, 1, 0, uint64(i+1), ""))
+	}
+	b := NewBlock(Hash{}, 0, 1, 0, 0, from, Hash{}, trxs)
+
+	trxHash, err := trxs[1].Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proof, err := b.TrxProof(trxHash)
+	if err != nil {
+		t.Fatalf("error building proof: %v", err)
+	}
+	if proof.Leaf != trxHash || !VerifyMerkleProof(b.Header.TrxRoot, proof) {
+		t.Errorf("proof should verify against the header transactions root")
+	}
+
+	var notFound ErrTrxNotFound
+	if _, err := b.TrxProof(Hash{1}); !errors.As(err, &notFound) {
+		t.Errorf("expected transaction not found error, got: %v", err)
+	}
+
+	b.TRXs[0], b.TRXs[1] = b.TRXs[1], b.TRXs[0]
+	if err := b.verifyTrxRoot(); err == nil {
+		t.Errorf("reordered transactions should no longer match the header root")
+	}
+}
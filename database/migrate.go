@@ -0,0 +1,130 @@
+package database
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"github.com/marc-watters/the-block-chain-bar/v2/fs"
+)
+
+// MigrateBlocksDB converts a JSON-lines block.db to the binary format,
+// keeping it in block.db.json. The hashes change with the encoding, so the
+// nonces are searched again.
+func MigrateBlocksDB(dataDir string) (uint64, error) {
+	path := fs.GetBlocksDBFilePath(dataDir)
+
+	content, err := fs.AppFS.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	if bytes.HasPrefix(content, blocksDBMagic) {
+		return 0, fmt.Errorf("'%s' already holds binary records", path)
+	}
+
+	blocks, err := decodeJSONBlocks(content)
+	if err != nil {
+		return 0, fmt.Errorf("unable to read '%s': %w", path, err)
+	}
+
+	var records bytes.Buffer
+	records.Write(blocksDBMagic)
+
+	var parent Hash
+	for i, blockFS := range blocks {
+		b := blockFS.Value
+
+		if b.Header.Height != uint64(i) {
+			return 0, fmt.Errorf("block '%s' should be at height %d not %d", blockFS.Key.Hex(), i, b.Header.Height)
+		}
+		if i > 0 && b.Header.Parent != blocks[i-1].Key {
+			return 0, fmt.Errorf("block %d isn't linked to block %d", i, i-1)
+		}
+
+		b.Header.Parent = parent
+		if b.Header.TrxRoot, err = b.TrxRoot(); err != nil {
+			return 0, err
+		}
+
+		hash, err := b.seal()
+		if err != nil {
+			return 0, err
+		}
+
+		record, err := BlockFS{hash, b}.Encode()
+		if err != nil {
+			return 0, err
+		}
+		records.Write(record)
+
+		parent = hash
+	}
+
+	if err := writeFileAtomic(path+".json", content, true); err != nil {
+		return 0, err
+	}
+	if err := writeFileAtomic(path, records.Bytes(), true); err != nil {
+		return 0, err
+	}
+
+	return uint64(len(blocks)), nil
+}
+
+// decodeJSONBlocks reads the records of a JSON-lines block.db.
+func decodeJSONBlocks(content []byte) ([]BlockFS, error) {
+	records, err := decodeJSONLines(content)
+	if err != nil {
+		return nil, err
+	}
+
+	blocks := make([]BlockFS, 0, len(records))
+	for i, record := range records {
+		var blockFS BlockFS
+		if err := json.Unmarshal(record, &blockFS); err != nil {
+			return nil, fmt.Errorf("record %d: %v", i, err)
+		}
+		blocks = append(blocks, blockFS)
+	}
+
+	return blocks, nil
+}
+
+// decodeJSONLines splits JSON-lines content into its records.
+func decodeJSONLines(content []byte) ([][]byte, error) {
+	records := make([][]byte, 0)
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), 2*MaxBlockSize)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		records = append(records, bytes.Clone(scanner.Bytes()))
+	}
+
+	return records, scanner.Err()
+}
+
+// seal searches the first nonce meeting the block difficulty.
+func (b *Block) seal() (Hash, error) {
+	if b.Header.Difficulty == 0 {
+		return Hash{}, fmt.Errorf("block %d has no difficulty to meet", b.Header.Height)
+	}
+
+	for nonce := uint64(0); nonce <= math.MaxUint32; nonce++ {
+		b.Header.Nonce = uint32(nonce)
+
+		hash, err := b.Hash()
+		if err != nil {
+			return Hash{}, err
+		}
+		if hash.MeetsDifficulty(b.Header.Difficulty) {
+			return hash, nil
+		}
+	}
+
+	return Hash{}, fmt.Errorf("no nonce meets the difficulty of block %d", b.Header.Height)
+}
@@ -0,0 +1,95 @@
+package database
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/marc-watters/the-block-chain-bar/v2/fs"
+)
+
+func TestMigrateBlocksDB(t *testing.T) {
+	privKey, from := generateTestKey(t)
+	to := common.HexToAddress("0x6fdc0d8d15ae6b4ebf45c52fd2aafbcbb19a65c8")
+	andrej := common.HexToAddress("0x3eb92807f1f91a8d4d85bc908c7f86dcddb1df57")
+
+	dataDir := setupTestDataDirWithGenesis(t, fmt.Sprintf(
+		`{"difficulty": 16, "retarget_interval": 0, "balances": {"%s": 1000}}`, from.Hex()))
+
+	trx := signTestTrx(t, privKey, NewTrx(from, to, 10, 1, 1, ""))
+	trxHash, err := trx.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := uint64(time.Now().UnixNano())
+
+	// Records as written before the binary encoding: their hashes, parent
+	// links, transaction roots and nonces don't hold under it.
+	a0 := NewBlock(Hash{}, 0, 16, 0, now, andrej, StateRoot(map[common.Address]uint64{from: 1000, andrej: BlockReward}, nil), []SignedTrx{})
+	a1 := NewBlock(Hash{1}, 1, 16, 0, now+1, andrej, StateRoot(
+		map[common.Address]uint64{from: 989, to: 10, andrej: 2*BlockReward + 1},
+		map[common.Address]uint64{from: 1},
+	), []SignedTrx{trx})
+	a1.Header.TrxRoot = Hash{}
+
+	var content []byte
+	for i, b := range []Block{a0, a1} {
+		record, err := json.Marshal(BlockFS{Hash{byte(i + 1)}, b})
+		if err != nil {
+			t.Fatal(err)
+		}
+		content = append(append(content, record...), '\n')
+	}
+	if err := fs.AppFS.WriteFile(fs.GetBlocksDBFilePath(dataDir), content, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var legacy ErrLegacyBlocksDB
+	if _, err := NewStateFromDisk(dataDir); !errors.As(err, &legacy) {
+		t.Fatalf("expected a legacy block.db error, got: %v", err)
+	}
+
+	// Leftovers of an interrupted migration are replaced.
+	for _, leftover := range []string{".json", ".tmp"} {
+		if err := fs.AppFS.WriteFile(fs.GetBlocksDBFilePath(dataDir)+leftover, []byte("torn"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	migrated, err := MigrateBlocksDB(dataDir)
+	if err != nil {
+		t.Fatalf("error migrating block.db: %v", err)
+	}
+	if migrated != 2 {
+		t.Errorf("2 blocks should be migrated not %d", migrated)
+	}
+
+	if backup, err := fs.AppFS.ReadFile(fs.GetBlocksDBFilePath(dataDir) + ".json"); err != nil || !bytes.Equal(backup, content) {
+		t.Errorf("the JSON records should be kept: %v", err)
+	}
+
+	s, err := NewStateFromDisk(dataDir)
+	if err != nil {
+		t.Fatalf("error loading migrated state: %v", err)
+	}
+	defer s.Close()
+
+	if s.LatestBlock().Header.Height != 1 {
+		t.Errorf("latest block should be at height 1 not %d", s.LatestBlock().Header.Height)
+	}
+	if s.Balances()[to] != 10 {
+		t.Errorf("balance of %s should be 10 not %d", to.Hex(), s.Balances()[to])
+	}
+	if _, _, err := s.GetTrx(trxHash); err != nil {
+		t.Errorf("error looking up migrated transaction: %v", err)
+	}
+
+	if _, err := MigrateBlocksDB(dataDir); err == nil {
+		t.Errorf("expected migrating a binary block.db to fail")
+	}
+}
@@ -0,0 +1,79 @@
+package database
+
+import (
+	"fmt"
+)
+
+// MinPruneKeep is the fewest blocks a pruned node keeps to still reorganize.
+const MinPruneKeep = maxForkDepth
+
+// WithPruning discards blocks older than the latest keep blocks and the
+// snapshot preceding them, see WithSnapshotInterval. Zero keeps every block.
+func WithPruning(keep uint64) Option {
+	return func(o *options) {
+		o.pruneKeep = keep
+	}
+}
+
+// FirstBlockHeight returns the height of the first stored block.
+func (s *State) FirstBlockHeight() uint64 {
+	return s.store.Base()
+}
+
+// prune discards the blocks, and their index entries, older than the
+// snapshot preceding the blocks to keep.
+func (s *State) prune() error {
+	if s.pruneKeep == 0 || s.store.Len() <= s.pruneKeep {
+		return nil
+	}
+
+	snapshot, ok, err := s.latestSnapshot(s.store.Len() - s.pruneKeep - 1)
+	if err != nil || !ok {
+		return err
+	}
+
+	// The blocks are read ahead as the engine may prune fewer of them.
+	previousBase := s.store.Base()
+	target := s.snapshotBase(snapshot.Height)
+	blocks := make([]BlockFS, 0)
+	for height := previousBase; height < target; height++ {
+		blockFS, err := s.store.BlockByHeight(height)
+		if err != nil {
+			return err
+		}
+		blocks = append(blocks, blockFS)
+	}
+
+	base, err := s.store.Prune(target)
+	if err != nil {
+		return err
+	}
+	if base == previousBase {
+		return nil
+	}
+
+	for _, blockFS := range blocks {
+		if blockFS.Value.Header.Height >= base {
+			break
+		}
+		if err := s.unindexTRXs(blockFS); err != nil {
+			return err
+		}
+		if err := s.pruneHistory(blockFS, base); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("Pruned the blocks below height %d\n", base)
+
+	return nil
+}
+
+// snapshotBase returns the lowest block height restoreSnapshot reads.
+func (s *State) snapshotBase(height uint64) uint64 {
+	base := height - min(height, medianTimeSpan-1)
+	if s.params.RetargetInterval > 0 {
+		base = min(base, height-height%s.params.RetargetInterval)
+	}
+	return base
+}
@@ -0,0 +1,92 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestPrune(t *testing.T) {
+	for _, tc := range []struct {
+		engine      string
+		segmentSize int64
+	}{
+		{EngineFile, 1},
+		{EngineFile, DefaultSegmentSize},
+		{EngineLevelDB, DefaultSegmentSize},
+	} {
+		t.Run(fmt.Sprintf("%s/segment size %d", tc.engine, tc.segmentSize), func(t *testing.T) {
+			dataDir := setupTestDataDirWithGenesis(t, testGenesisJSON)
+			andrej := common.HexToAddress("0x3eb92807f1f91a8d4d85bc908c7f86dcddb1df57")
+
+			// The file engine prunes the same blocks whether they were sealed
+			// one by one or are all still in block.db.
+			opts := []Option{
+				WithEngine(tc.engine),
+				WithSyncPolicy(SyncNever),
+				WithSegmentSize(tc.segmentSize),
+				WithSnapshotInterval(10),
+				WithPruning(MinPruneKeep),
+			}
+
+			s, err := NewStateFromDisk(dataDir, opts...)
+			if err != nil {
+				t.Fatalf("error creating state: %v", err)
+			}
+
+			var parent Hash
+			for height := uint64(0); height <= MinPruneKeep+30; height++ {
+				b := mineTestBlock(t, parent, height, 16, andrej, map[common.Address]uint64{andrej: (height + 1) * BlockReward})
+				parent = addTestBlock(t, s, b)
+			}
+
+			// The latest snapshot before the kept blocks is at height 30 and
+			// restoring it needs the 10 blocks before it.
+			assertPruned := func(s *State) {
+				t.Helper()
+
+				if s.FirstBlockHeight() != 20 {
+					t.Fatalf("blocks should be stored from height 20 not %d", s.FirstBlockHeight())
+				}
+
+				var pruned ErrBlockPruned
+				if _, err := s.GetBlockByHeight(19); !errors.As(err, &pruned) {
+					t.Errorf("expected block 19 to be pruned, got: %v", err)
+				}
+				if _, err := s.GetBlocksAfter(Hash{}, math.MaxUint64); !errors.As(err, &pruned) {
+					t.Errorf("expected the whole chain to be unavailable, got: %v", err)
+				}
+				if _, _, err := s.BalancesAt(10); !errors.As(err, &pruned) {
+					t.Errorf("expected the balances at a pruned height to be unavailable, got: %v", err)
+				}
+
+				if _, err := s.GetBlockByHeight(20); err != nil {
+					t.Errorf("error reading the first stored block: %v", err)
+				}
+				if s.LatestBlockHash() != parent {
+					t.Errorf("latest block should be %s not %s", parent.Hex(), s.LatestBlockHash().Hex())
+				}
+				if s.Balances()[andrej] != (MinPruneKeep+31)*BlockReward {
+					t.Errorf("unexpected balance %d", s.Balances()[andrej])
+				}
+			}
+
+			assertPruned(s)
+
+			if err := s.Close(); err != nil {
+				t.Fatalf("error closing state: %v", err)
+			}
+
+			s, err = NewStateFromDisk(dataDir, opts...)
+			if err != nil {
+				t.Fatalf("error reloading pruned state: %v", err)
+			}
+			defer s.Close()
+
+			assertPruned(s)
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+)
+
+// Rollback drops every block above height and returns how many were
+// dropped.
+func (s *State) Rollback(height uint64) (uint64, error) {
+	if height >= s.NextBlockHeight() {
+		return 0, NewBlockNotFound(fmt.Sprintf("%d", height))
+	}
+
+	lowest, err := s.FirstRollbackHeight()
+	if err != nil {
+		return 0, err
+	}
+	if height < lowest {
+		return 0, NewBlockPruned(height, lowest)
+	}
+
+	heights, err := s.snapshotHeights()
+	if err != nil {
+		return 0, err
+	}
+
+	length := height + 1
+	dropped := s.store.Len() - length
+	if dropped == 0 {
+		return 0, nil
+	}
+
+	pendingState, err := s.rewind(length)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := s.unindexBlocks(length); err != nil {
+		return 0, err
+	}
+	if err := s.store.Truncate(length); err != nil {
+		return 0, err
+	}
+
+	s.commit(pendingState)
+
+	kept := slices.DeleteFunc(slices.Clone(heights), func(h uint64) bool { return h > height })
+	heightsJSON, err := json.Marshal(kept)
+	if err != nil {
+		return dropped, err
+	}
+	if err := s.store.PutState(snapshotsKey, heightsJSON); err != nil {
+		return dropped, err
+	}
+
+	for _, h := range heights[len(kept):] {
+		if err := s.store.DeleteState(snapshotKey(h)); err != nil {
+			return dropped, err
+		}
+	}
+
+	return dropped, nil
+}
+
+// FirstRollbackHeight returns the lowest height the chain can be rolled
+// back to, the oldest restorable snapshot once blocks were pruned.
+func (s *State) FirstRollbackHeight() (uint64, error) {
+	base := s.store.Base()
+	if base == 0 {
+		return 0, nil
+	}
+
+	heights, err := s.snapshotHeights()
+	if err != nil {
+		return 0, err
+	}
+
+	if snapshot, ok := s.oldestRestorableSnapshot(heights, base); ok {
+		return snapshot.Height, nil
+	}
+	return s.latestBlock.Header.Height, nil
+}
@@ -0,0 +1,166 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestRollback(t *testing.T) {
+	privKey, from := generateTestKey(t)
+	to := common.HexToAddress("0x6fdc0d8d15ae6b4ebf45c52fd2aafbcbb19a65c8")
+	miner := common.HexToAddress("0x3eb92807f1f91a8d4d85bc908c7f86dcddb1df57")
+
+	dataDir := setupTestDataDirWithGenesis(t, fmt.Sprintf(
+		`{"chain_id": "", "difficulty": 16, "retarget_interval": 0, "balances": {"%s": 1000}}`, from.Hex()))
+
+	s, err := NewStateFromDisk(dataDir, WithSnapshotInterval(2))
+	if err != nil {
+		t.Fatalf("error creating state: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	mineBlock := func(trxs []SignedTrx) Hash {
+		t.Helper()
+
+		stateRoot, err := s.PendingStateRoot(miner, trxs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b := NewBlock(s.LatestBlockHash(), s.NextBlockHeight(), 16, 0, uint64(time.Now().UnixNano()), miner, stateRoot, trxs)
+		if _, err := b.seal(); err != nil {
+			t.Fatal(err)
+		}
+		return addTestBlock(t, s, b)
+	}
+
+	mineBlock(nil)
+	kept := mineBlock(nil)
+
+	trx := signTestTrx(t, privKey, NewTrx(from, to, 10, 1, 1, ""))
+	trxHash, err := trx.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mineBlock([]SignedTrx{trx})
+	mineBlock(nil)
+
+	snapshots, err := s.snapshotHeights()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dropped, err := s.Rollback(1)
+	if err != nil {
+		t.Fatalf("error rolling back: %v", err)
+	}
+	if dropped != 2 {
+		t.Errorf("2 blocks should be dropped not %d", dropped)
+	}
+
+	assertRolledBack := func(s *State) {
+		t.Helper()
+
+		if s.LatestBlockHash() != kept || s.NextBlockHeight() != 2 {
+			t.Errorf("latest block should be %s at height 1", kept.Hex())
+		}
+		if s.Balances()[from] != 1000 || s.Balances()[to] != 0 || s.Balances()[miner] != 2*BlockReward {
+			t.Errorf("unexpected balances after rolling back: %v", s.Balances())
+		}
+		var notFound ErrTrxNotFound
+		if _, _, err := s.GetTrx(trxHash); !errors.As(err, &notFound) {
+			t.Errorf("the dropped transaction should no longer be found, got: %v", err)
+		}
+		if _, total, err := s.AccountHistory(to, 0, 10); err != nil || total != 0 {
+			t.Errorf("the dropped transaction should leave the history, %d entries remain: %v", total, err)
+		}
+		if heights, err := s.snapshotHeights(); err != nil || len(heights) != 0 {
+			t.Errorf("the snapshot of a dropped block should be forgotten, got %v: %v", heights, err)
+		}
+		var stateNotFound ErrStateNotFound
+		for _, height := range snapshots {
+			if _, err := s.loadSnapshot(height); !errors.As(err, &stateNotFound) {
+				t.Errorf("the snapshot at height %d should be removed, got: %v", height, err)
+			}
+		}
+	}
+
+	assertRolledBack(s)
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	s, err = NewStateFromDisk(dataDir, WithSnapshotInterval(2))
+	if err != nil {
+		t.Fatalf("error reloading state: %v", err)
+	}
+
+	assertRolledBack(s)
+
+	if _, err := s.Rollback(5); err == nil {
+		t.Errorf("expected rolling back to a missing height to fail")
+	}
+
+	// The dropped transaction can be mined again.
+	mineBlock([]SignedTrx{trx})
+	if s.Balances()[to] != 10 {
+		t.Errorf("the transaction should apply again after rolling back, balance is %d", s.Balances()[to])
+	}
+}
+
+func TestRollback_Pruned(t *testing.T) {
+	dataDir := setupTestDataDirWithGenesis(t, testGenesisJSON)
+	andrej := common.HexToAddress("0x3eb92807f1f91a8d4d85bc908c7f86dcddb1df57")
+
+	s, err := NewStateFromDisk(dataDir, WithSyncPolicy(SyncNever), WithSnapshotInterval(10), WithPruning(MinPruneKeep))
+	if err != nil {
+		t.Fatalf("error creating state: %v", err)
+	}
+	defer s.Close()
+
+	var parent Hash
+	for height := uint64(0); height <= MinPruneKeep+30; height++ {
+		b := mineTestBlock(t, parent, height, 16, andrej, map[common.Address]uint64{andrej: (height + 1) * BlockReward})
+		parent = addTestBlock(t, s, b)
+	}
+
+	// Blocks are stored from height 20, but the snapshot at height 20 needs
+	// the blocks before it, so the one at height 30 is the oldest restorable.
+	if s.FirstBlockHeight() != 20 {
+		t.Fatalf("blocks should be stored from height 20 not %d", s.FirstBlockHeight())
+	}
+
+	if lowest, err := s.FirstRollbackHeight(); err != nil || lowest != 30 {
+		t.Errorf("chain should be rolled back to height 30 at the lowest, got %d: %v", lowest, err)
+	}
+
+	var pruned ErrBlockPruned
+	if _, err := s.Rollback(25); !errors.As(err, &pruned) || pruned.Base != 30 {
+		t.Fatalf("expected rolling back below the oldest restorable snapshot to fail, got: %v", err)
+	}
+	if s.LatestBlockHash() != parent || s.NextBlockHeight() != MinPruneKeep+31 {
+		t.Errorf("a rejected rollback shouldn't drop any block")
+	}
+
+	if _, err := s.Rollback(35); err != nil {
+		t.Fatalf("error rolling back: %v", err)
+	}
+	if s.NextBlockHeight() != 36 || s.Balances()[andrej] != 36*BlockReward {
+		t.Errorf("chain should end at height 35, got height %d and balance %d", s.NextBlockHeight()-1, s.Balances()[andrej])
+	}
+
+	heights, err := s.snapshotHeights()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(heights) == 0 || heights[len(heights)-1] != 30 {
+		t.Errorf("the snapshots of the dropped blocks should be removed, got %v", heights)
+	}
+	var stateNotFound ErrStateNotFound
+	if _, err := s.loadSnapshot(40); !errors.As(err, &stateNotFound) {
+		t.Errorf("the snapshot at height 40 should be removed, got: %v", err)
+	}
+}
@@ -0,0 +1,450 @@
+package database
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/golang/snappy"
+
+	"github.com/marc-watters/the-block-chain-bar/v2/fs"
+)
+
+const (
+	// DefaultSegmentSize is the size of block.db records sealed into a segment.
+	DefaultSegmentSize = 16 << 20
+
+	segmentCompression = "snappy"
+	manifestFile       = "manifest.json"
+
+	// activeSegment marks the blocks stored in block.db.
+	activeSegment = -1
+)
+
+type (
+	// segmentManifest lists the sealed segments in height order. Base is
+	// the height of the first stored block.
+	segmentManifest struct {
+		Base        uint64           `json:"base"`
+		SegmentSize int64            `json:"segment_size"`
+		Compression string           `json:"compression"`
+		Segments    []segmentInfo    `json:"segments"`
+		Unsealing   *unsealedSegment `json:"unsealing,omitempty"`
+	}
+
+	// unsealedSegment is a truncated segment whose first Kept bytes of
+	// records move back into block.db.
+	unsealedSegment struct {
+		Segment segmentInfo `json:"segment"`
+		Kept    int64       `json:"kept"`
+	}
+
+	// segmentInfo describes a segment file. Size is the length of the
+	// uncompressed records and Checksum the SHA-256 of the file.
+	segmentInfo struct {
+		File        string `json:"file"`
+		FirstHeight uint64 `json:"first_height"`
+		Blocks      uint64 `json:"blocks"`
+		Size        int64  `json:"size"`
+		Checksum    Hash   `json:"checksum"`
+	}
+
+	// segmentCache holds the records of the last read segment.
+	segmentCache struct {
+		segment int
+		data    []byte
+	}
+)
+
+// sealedLen is the number of blocks stored in sealed segments.
+func (m segmentManifest) sealedLen() uint64 {
+	if len(m.Segments) == 0 {
+		return m.Base
+	}
+	last := m.Segments[len(m.Segments)-1]
+	return last.FirstHeight + last.Blocks
+}
+
+// loadManifest reads the segment manifest, starting a new one if missing.
+func (s *fileStorage) loadManifest(segmentSize int64) error {
+	manifestJSON, err := fs.AppFS.ReadFile(filepath.Join(s.segmentsDir, manifestFile))
+	if os.IsNotExist(err) {
+		s.manifest = segmentManifest{0, segmentSize, segmentCompression, make([]segmentInfo, 0), nil}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(manifestJSON, &s.manifest); err != nil {
+		return fmt.Errorf("unable to read segment manifest: %v", err)
+	}
+
+	if s.manifest.Compression != segmentCompression {
+		return fmt.Errorf("unsupported segment compression '%s'", s.manifest.Compression)
+	}
+	if s.manifest.SegmentSize <= 0 {
+		return fmt.Errorf("invalid segment size '%d'", s.manifest.SegmentSize)
+	}
+
+	return nil
+}
+
+func (s *fileStorage) writeManifest(m segmentManifest) error {
+	if err := fs.AppFS.MkdirAll(s.segmentsDir, os.ModePerm); err != nil {
+		return err
+	}
+
+	manifestJSON, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(filepath.Join(s.segmentsDir, manifestFile), manifestJSON, s.sync)
+}
+
+// indexSegments adds the blocks of every sealed segment to the index.
+func (s *fileStorage) indexSegments() error {
+	s.index.base = s.manifest.Base
+
+	for i, info := range s.manifest.Segments {
+		data, err := s.segment(i)
+		if err != nil {
+			return s.damagedAt(err)
+		}
+
+		stream := rlp.NewStream(bytes.NewReader(data), uint64(len(data)))
+		var offset int64
+		for {
+			record, err := stream.Raw()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return s.damagedAt(fmt.Errorf("corrupted block record in segment '%s' at offset %d: %v", info.File, offset, err))
+			}
+
+			blockFS, err := DecodeBlockFS(record)
+			if err != nil {
+				return s.damagedAt(fmt.Errorf("corrupted block record in segment '%s' at offset %d: %v", info.File, offset, err))
+			}
+
+			ref := blockRef{i, offset, int64(len(record))}
+			if err := s.index.add(blockFS.Value.Header.Height, blockFS.Key, ref); err != nil {
+				return s.damagedAt(err)
+			}
+			offset += ref.size
+		}
+
+		if s.index.len() != info.FirstHeight+info.Blocks {
+			return s.damagedAt(fmt.Errorf("segment '%s' should end at height %d not %d", info.File, info.FirstHeight+info.Blocks, s.index.len()))
+		}
+	}
+
+	return nil
+}
+
+// segment returns the uncompressed records of a sealed segment.
+func (s *fileStorage) segment(i int) ([]byte, error) {
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+
+	if s.cache.data != nil && s.cache.segment == i {
+		return s.cache.data, nil
+	}
+
+	data, err := s.readSegment(s.manifest.Segments[i])
+	if err != nil {
+		return nil, err
+	}
+
+	s.cache = segmentCache{i, data}
+
+	return data, nil
+}
+
+func (s *fileStorage) readSegment(info segmentInfo) ([]byte, error) {
+	compressed, err := fs.AppFS.ReadFile(filepath.Join(s.segmentsDir, info.File))
+	if err != nil {
+		return nil, err
+	}
+	if sha256.Sum256(compressed) != info.Checksum {
+		return nil, fmt.Errorf("segment '%s' doesn't match its checksum", info.File)
+	}
+
+	data, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decompress segment '%s': %v", info.File, err)
+	}
+	if int64(len(data)) != info.Size {
+		return nil, fmt.Errorf("segment '%s' should hold %d bytes not %d", info.File, info.Size, len(data))
+	}
+
+	return data, nil
+}
+
+// sealFullSegments seals block.db while it holds a segment's worth of records.
+func (s *fileStorage) sealFullSegments() error {
+	for {
+		end := s.manifest.sealedLen()
+		for ; end < s.index.len(); end++ {
+			ref := s.index.at(end)
+			if ref.offset+ref.size-int64(len(blocksDBMagic)) >= s.manifest.SegmentSize {
+				break
+			}
+		}
+		if end == s.index.len() {
+			return nil
+		}
+
+		if err := s.seal(end + 1); err != nil {
+			return err
+		}
+	}
+}
+
+// seal moves the block.db records below height end into a new segment. The
+// manifest is written first, stale records are dropped on open.
+func (s *fileStorage) seal(end uint64) error {
+	headerSize := int64(len(blocksDBMagic))
+
+	first := s.manifest.sealedLen()
+	endOffset := s.dbSize
+	if end < s.index.len() {
+		endOffset = s.index.at(end).offset
+	}
+
+	records := make([]byte, s.dbSize-headerSize)
+	if _, err := s.db.ReadAt(records, headerSize); err != nil {
+		return err
+	}
+	sealed, rest := records[:endOffset-headerSize], records[endOffset-headerSize:]
+
+	compressed := snappy.Encode(nil, sealed)
+	info := segmentInfo{
+		File:        fmt.Sprintf("%012d.sz", first),
+		FirstHeight: first,
+		Blocks:      end - first,
+		Size:        int64(len(sealed)),
+		Checksum:    sha256.Sum256(compressed),
+	}
+
+	if err := fs.AppFS.MkdirAll(s.segmentsDir, os.ModePerm); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(s.segmentsDir, info.File), compressed, s.sync); err != nil {
+		return err
+	}
+
+	manifest := s.manifest
+	manifest.Segments = append(manifest.Segments[:len(manifest.Segments):len(manifest.Segments)], info)
+	if err := s.writeManifest(manifest); err != nil {
+		return err
+	}
+	s.manifest = manifest
+
+	if err := s.rewriteActive(rest); err != nil {
+		return err
+	}
+
+	segment := len(s.manifest.Segments) - 1
+	for height := first; height < s.index.len(); height++ {
+		ref := s.index.at(height)
+		if height < end {
+			ref.segment, ref.offset = segment, ref.offset-headerSize
+		} else {
+			ref.offset -= endOffset - headerSize
+		}
+	}
+
+	s.cacheMu.Lock()
+	s.cache = segmentCache{segment, sealed}
+	s.cacheMu.Unlock()
+
+	return nil
+}
+
+// truncateSegments truncates the chain at a height within the sealed
+// segments.
+func (s *fileStorage) truncateSegments(length uint64) error {
+	headerSize := int64(len(blocksDBMagic))
+
+	i := s.index.at(length).segment
+	data, err := s.segment(i)
+	if err != nil {
+		return err
+	}
+
+	dropped := s.manifest.Segments[i:]
+	if err := s.dropSegments(i, length); err != nil {
+		return err
+	}
+	if err := s.unseal(data); err != nil {
+		return err
+	}
+
+	for _, info := range dropped[1:] {
+		if err := fs.AppFS.Remove(filepath.Join(s.segmentsDir, info.File)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	for height := s.manifest.sealedLen(); height < length; height++ {
+		ref := s.index.at(height)
+		ref.segment, ref.offset = activeSegment, ref.offset+headerSize
+	}
+	s.index.truncate(length)
+
+	s.cacheMu.Lock()
+	s.cache = segmentCache{}
+	s.cacheMu.Unlock()
+
+	return nil
+}
+
+// dropSegments drops the segments from the i-th one, recording the one to
+// unseal.
+func (s *fileStorage) dropSegments(i int, length uint64) error {
+	manifest := s.manifest
+	manifest.Segments = manifest.Segments[:i:i]
+	manifest.Unsealing = &unsealedSegment{s.manifest.Segments[i], s.index.at(length).offset}
+	if err := s.writeManifest(manifest); err != nil {
+		return err
+	}
+	s.manifest = manifest
+
+	return nil
+}
+
+// unseal moves the kept records of the unsealed segment into block.db.
+func (s *fileStorage) unseal(data []byte) error {
+	u := s.manifest.Unsealing
+	if u.Kept > int64(len(data)) {
+		return fmt.Errorf("segment '%s' holds fewer than the %d bytes to unseal", u.Segment.File, u.Kept)
+	}
+
+	if err := s.rewriteActive(data[:u.Kept]); err != nil {
+		return err
+	}
+
+	manifest := s.manifest
+	manifest.Unsealing = nil
+	if err := s.writeManifest(manifest); err != nil {
+		return err
+	}
+	s.manifest = manifest
+
+	err := fs.AppFS.Remove(filepath.Join(s.segmentsDir, u.Segment.File))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// resumeUnseal completes an interrupted truncation.
+func (s *fileStorage) resumeUnseal() error {
+	u := s.manifest.Unsealing
+	if s.readOnly {
+		return s.damagedAt(fmt.Errorf("truncation of segment '%s' was interrupted", u.Segment.File))
+	}
+
+	data, err := s.readSegment(u.Segment)
+	if err != nil {
+		return fmt.Errorf("unable to resume the truncation of segment '%s': %v", u.Segment.File, err)
+	}
+	if err := s.unseal(data); err != nil {
+		return err
+	}
+
+	// The unsealed records are indexed with the rest of block.db.
+	s.dbSize = int64(len(blocksDBMagic))
+
+	return nil
+}
+
+// Prune drops the segments, then the block.db records, below base. The
+// manifest is written first, open drops records left by an interruption.
+func (s *fileStorage) Prune(base uint64) (uint64, error) {
+	if s.readOnly {
+		return s.index.base, errReadOnlyStorage
+	}
+	base = min(base, s.index.len())
+
+	n := 0
+	for n < len(s.manifest.Segments) && s.manifest.Segments[n].FirstHeight+s.manifest.Segments[n].Blocks <= base {
+		n++
+	}
+
+	manifest := s.manifest
+	dropped := manifest.Segments[:n]
+	manifest.Segments = slices.Clone(manifest.Segments[n:])
+	if n > 0 {
+		manifest.Base = dropped[n-1].FirstHeight + dropped[n-1].Blocks
+	}
+	if len(manifest.Segments) == 0 {
+		manifest.Base = max(manifest.Base, base)
+	}
+	if manifest.Base == s.index.base {
+		return s.index.base, nil
+	}
+
+	if err := s.writeManifest(manifest); err != nil {
+		return s.index.base, err
+	}
+	s.manifest = manifest
+
+	for _, info := range dropped {
+		if err := fs.AppFS.Remove(filepath.Join(s.segmentsDir, info.File)); err != nil && !os.IsNotExist(err) {
+			return s.index.base, err
+		}
+	}
+
+	if len(manifest.Segments) == 0 {
+		staleEnd := s.dbSize
+		if manifest.Base < s.index.len() {
+			staleEnd = s.index.at(manifest.Base).offset
+		}
+		if err := s.dropStaleRecords(staleEnd); err != nil {
+			return s.index.base, err
+		}
+	}
+
+	s.index.prune(manifest.Base)
+	for height := manifest.Base; height < manifest.sealedLen(); height++ {
+		s.index.at(height).segment -= n
+	}
+
+	s.cacheMu.Lock()
+	s.cache = segmentCache{}
+	s.cacheMu.Unlock()
+
+	return manifest.Base, nil
+}
+
+// rewriteActive replaces block.db with one holding the given records.
+func (s *fileStorage) rewriteActive(records []byte) error {
+	content := append(append(make([]byte, 0, len(blocksDBMagic)+len(records)), blocksDBMagic...), records...)
+	if err := writeFileAtomic(s.dbPath, content, true); err != nil {
+		return err
+	}
+
+	if err := s.db.Close(); err != nil {
+		return err
+	}
+
+	db, err := fs.AppFS.OpenFile(s.dbPath, os.O_APPEND|os.O_RDWR, 0o600)
+	if err != nil {
+		return err
+	}
+
+	s.db = db
+	s.dbSize = int64(len(content))
+
+	return nil
+}
@@ -0,0 +1,177 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const (
+	DefaultSnapshotInterval = 100
+
+	snapshotsKey = "snapshots"
+)
+
+// Snapshot captures the account balances and nonces after the block at
+// Height.
+type Snapshot struct {
+	Height    uint64                    `json:"height"`
+	Hash      Hash                      `json:"block_hash"`
+	ChainWork uint64                    `json:"chain_work"`
+	Balances  map[common.Address]uint64 `json:"balances"`
+	Nonces    map[common.Address]uint64 `json:"nonces"`
+}
+
+// Snapshot persists the balances at the latest block.
+func (s *State) Snapshot() (Snapshot, error) {
+	if !s.hasGenesisBlock {
+		return Snapshot{}, fmt.Errorf("no blocks to snapshot")
+	}
+
+	snapshot := Snapshot{
+		Height:    s.latestBlock.Header.Height,
+		Hash:      s.latestBlockHash,
+		ChainWork: s.chainWork,
+		Balances:  make(map[common.Address]uint64),
+		Nonces:    make(map[common.Address]uint64),
+	}
+	maps.Copy(snapshot.Balances, s.balances)
+	maps.Copy(snapshot.Nonces, s.accountNonces)
+
+	snapshotJSON, err := json.Marshal(snapshot)
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	if err := s.store.PutState(snapshotKey(snapshot.Height), snapshotJSON); err != nil {
+		return Snapshot{}, err
+	}
+
+	heights, err := s.snapshotHeights()
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	if !slices.Contains(heights, snapshot.Height) {
+		heights = append(heights, snapshot.Height)
+		slices.Sort(heights)
+	}
+
+	heightsJSON, err := json.Marshal(heights)
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	if err := s.store.PutState(snapshotsKey, heightsJSON); err != nil {
+		return Snapshot{}, err
+	}
+
+	return snapshot, nil
+}
+
+// latestSnapshot returns the newest snapshot at or below maxHeight that
+// still matches the stored chain.
+func (s *State) latestSnapshot(maxHeight uint64) (Snapshot, bool, error) {
+	heights, err := s.snapshotHeights()
+	if err != nil {
+		return Snapshot{}, false, err
+	}
+
+	for i := len(heights) - 1; i >= 0; i-- {
+		if heights[i] > maxHeight || heights[i] >= s.store.Len() {
+			continue
+		}
+
+		snapshot, err := s.loadSnapshot(heights[i])
+		if err != nil {
+			continue
+		}
+
+		blockFS, err := s.store.BlockByHeight(snapshot.Height)
+		if err != nil || blockFS.Key != snapshot.Hash {
+			continue
+		}
+
+		return snapshot, true, nil
+	}
+
+	return Snapshot{}, false, nil
+}
+
+// loadSnapshot reads the snapshot taken at height.
+func (s *State) loadSnapshot(height uint64) (Snapshot, error) {
+	snapshotJSON, err := s.store.GetState(snapshotKey(height))
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	var snapshot Snapshot
+	if err := json.Unmarshal(snapshotJSON, &snapshot); err != nil {
+		return Snapshot{}, err
+	}
+
+	return snapshot, nil
+}
+
+func (s *State) restoreSnapshot(snapshot Snapshot) error {
+	blockFS, err := s.store.BlockByHeight(snapshot.Height)
+	if err != nil {
+		return err
+	}
+
+	s.balances = make(map[common.Address]uint64)
+	s.accountNonces = make(map[common.Address]uint64)
+	maps.Copy(s.balances, snapshot.Balances)
+	maps.Copy(s.accountNonces, snapshot.Nonces)
+	s.stateTree = newStateTree(s.balances, s.accountNonces)
+	s.latestBlock = blockFS.Value
+	s.latestBlockHash = blockFS.Key
+	s.hasGenesisBlock = true
+	s.chainWork = snapshot.ChainWork
+
+	if s.params.RetargetInterval > 0 {
+		periodStartFS, err := s.store.BlockByHeight(snapshot.Height - snapshot.Height%s.params.RetargetInterval)
+		if err != nil {
+			return err
+		}
+		s.periodStart = periodStartFS.Value.Header.Time
+	}
+
+	s.recentTimes = make([]uint64, 0, medianTimeSpan)
+	for height := snapshot.Height - min(snapshot.Height, medianTimeSpan-1); height <= snapshot.Height; height++ {
+		recentFS, err := s.store.BlockByHeight(height)
+		if err != nil {
+			return err
+		}
+		s.recentTimes = append(s.recentTimes, recentFS.Value.Header.Time)
+	}
+
+	return nil
+}
+
+func (s *State) snapshotHeights() ([]uint64, error) {
+	heights := make([]uint64, 0)
+
+	heightsJSON, err := s.store.GetState(snapshotsKey)
+	var notFound ErrStateNotFound
+	if errors.As(err, &notFound) {
+		return heights, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(heightsJSON, &heights); err != nil {
+		return nil, err
+	}
+
+	return heights, nil
+}
+
+func snapshotKey(height uint64) string {
+	return fmt.Sprintf("snapshot-%d", height)
+}
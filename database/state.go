@@ -1,95 +1,187 @@
 package database
 
 import (
-	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"maps"
 	"os"
 	"reflect"
-	"sort"
+	"slices"
 
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/spf13/afero"
 
 	"github.com/marc-watters/the-block-chain-bar/v2/fs"
 )
 
 type State struct {
-	balances        map[common.Address]uint64
-	latestBlock     Block
-	latestBlockHash Hash
-	hasGenesisBlock bool
-	dataDir         string
-	db              afero.File
+	balances         map[common.Address]uint64
+	accountNonces    map[common.Address]uint64
+	stateTree        *stateNode
+	genesisBalances  map[common.Address]uint64
+	genesis          Genesis
+	genesisTime      uint64
+	latestBlock      Block
+	latestBlockHash  Hash
+	hasGenesisBlock  bool
+	chainID          string
+	params           ChainParams
+	periodStart      uint64
+	recentTimes      []uint64
+	chainWork        uint64
+	sideBlocks       map[Hash]sideBlock
+	orphanedTRXs     []SignedTrx
+	dataDir          string
+	store            Storage
+	snapshotInterval uint64
+	pruneKeep        uint64
 }
 
-func NewStateFromDisk(dataDir string) (*State, error) {
+type (
+	// Option configures how NewStateFromDisk opens a data directory.
+	Option  func(*options)
+	options struct {
+		engine           string
+		syncPolicy       string
+		snapshotInterval uint64
+		segmentSize      int64
+		pruneKeep        uint64
+		readOnly         bool
+	}
+)
+
+// WithEngine selects the storage engine, detected when empty.
+func WithEngine(engine string) Option {
+	return func(o *options) {
+		o.engine = engine
+	}
+}
+
+// WithSyncPolicy sets the SyncAlways or SyncNever flush policy.
+func WithSyncPolicy(policy string) Option {
+	return func(o *options) {
+		o.syncPolicy = policy
+	}
+}
+
+// WithSnapshotInterval sets the blocks between snapshots, zero disabling them.
+func WithSnapshotInterval(interval uint64) Option {
+	return func(o *options) {
+		o.snapshotInterval = interval
+	}
+}
+
+// WithSegmentSize sets the size of the block.db records the file engine
+// seals into a segment, for data directories without segments yet.
+func WithSegmentSize(size int64) Option {
+	return func(o *options) {
+		o.segmentSize = size
+	}
+}
+
+func NewStateFromDisk(dataDir string, opts ...Option) (*State, error) {
 	dataDir = fs.ExpandPath(dataDir)
 
+	o := options{snapshotInterval: DefaultSnapshotInterval}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if o.pruneKeep > 0 && o.pruneKeep < MinPruneKeep {
+		return nil, fmt.Errorf("pruned nodes must keep at least %d blocks", MinPruneKeep)
+	}
+	if o.pruneKeep > 0 && o.snapshotInterval == 0 {
+		return nil, fmt.Errorf("pruning needs periodic snapshots")
+	}
+
 	err := fs.InitDataDirIfNotExists(dataDir, []byte(fs.GenesisJSON))
 	if err != nil {
 		return nil, err
 	}
 
-	s := &State{
-		balances:        make(map[common.Address]uint64),
-		latestBlock:     Block{},
-		latestBlockHash: Hash{},
-		hasGenesisBlock: false,
-		dataDir:         dataDir,
-		db:              nil,
-	}
-
-	g, err := loadGenesis(fs.GetGenesisJSONFilePath(dataDir))
+	s, err := openState(dataDir, o)
 	if err != nil {
 		return nil, err
 	}
-	maps.Copy(s.balances, g.Balances)
 
-	s.db, err = fs.AppFS.OpenFile(
-		fs.GetBlocksDBFilePath(dataDir),
-		os.O_APPEND|os.O_RDWR,
-		0o600,
-	)
+	if r, ok := s.store.Recovered(); ok {
+		fmt.Printf("Recovered from an unclean shutdown, discarded %d bytes of a torn block record at offset %d:\n", len(r.Discarded), r.Offset)
+		fmt.Printf("\t%x\n", r.Discarded)
+	}
+
+	loadedState, err := s.rewind(s.store.Len())
 	if err != nil {
+		s.store.Close()
 		return nil, err
 	}
+	s.commit(loadedState)
 
-	if _, err = s.db.Seek(0, io.SeekStart); err != nil {
+	if err := s.prune(); err != nil {
+		s.store.Close()
 		return nil, err
 	}
 
-	scanner := bufio.NewScanner(s.db)
-	for scanner.Scan() {
-		if err = scanner.Err(); err != nil {
-			return nil, err
-		}
+	if err := s.updateIndexes(); err != nil {
+		s.store.Close()
+		return nil, err
+	}
 
-		var blockFS BlockFS
-		blockFSJSON := scanner.Bytes()
-		err = json.Unmarshal(blockFSJSON, &blockFS)
-		if err != nil {
-			return nil, err
-		}
+	return s, nil
+}
 
-		if len(blockFSJSON) == 0 {
-			break
-		}
+// openState loads the genesis of a data directory and opens its storage.
+func openState(dataDir string, o options) (*State, error) {
+	s := &State{
+		balances:         make(map[common.Address]uint64),
+		accountNonces:    make(map[common.Address]uint64),
+		stateTree:        nil,
+		genesisBalances:  make(map[common.Address]uint64),
+		genesis:          Genesis{},
+		genesisTime:      0,
+		latestBlock:      Block{},
+		latestBlockHash:  Hash{},
+		hasGenesisBlock:  false,
+		chainID:          "",
+		params:           ChainParams{},
+		periodStart:      0,
+		recentTimes:      make([]uint64, 0),
+		chainWork:        0,
+		sideBlocks:       make(map[Hash]sideBlock),
+		orphanedTRXs:     make([]SignedTrx, 0),
+		dataDir:          dataDir,
+		store:            nil,
+		snapshotInterval: o.snapshotInterval,
+		pruneKeep:        o.pruneKeep,
+	}
 
-		if err := applyBlock(blockFS.Value, s); err != nil {
-			return nil, err
+	g, err := LoadGenesis(fs.GetGenesisJSONFilePath(dataDir))
+	if err != nil {
+		if IsLegacyDataDir(dataDir) {
+			return nil, NewLegacyDataDir(dataDir)
 		}
+		return nil, err
+	}
+	maps.Copy(s.genesisBalances, g.Balances)
+	s.genesis = g
+	s.genesisTime = g.timeNano()
+	s.chainID = g.ChainID
+	s.params = g.ChainParams.withDefaults()
+	if err := s.params.validate(); err != nil {
+		return nil, fmt.Errorf("invalid genesis: %w", err)
+	}
 
-		s.latestBlock = blockFS.Value
-		s.latestBlockHash = blockFS.Key
-		s.hasGenesisBlock = true
+	s.store, err = openStorage(dataDir, o)
+	if err != nil {
+		return nil, err
 	}
 
 	return s, nil
 }
 
+func (s *State) ChainID() string {
+	return s.chainID
+}
+
 func (s *State) DataDir() string {
 	return s.dataDir
 }
@@ -103,35 +195,46 @@ func (s *State) AddBlocks(blocks []Block) error {
 	return nil
 }
 
+// AddBlock appends a block to the main chain, or tracks it as a side chain
+// that replaces the main chain once it carries more work.
 func (s *State) AddBlock(b Block) (Hash, error) {
-	pendingState := s.copy()
-
-	if err := applyBlock(b, &pendingState); err != nil {
-		return Hash{}, err
-	}
-
 	blockHash, err := b.Hash()
 	if err != nil {
 		return Hash{}, err
 	}
 
-	blockFS := BlockFS{blockHash, b}
+	if _, ok := s.store.BlockHeight(blockHash); ok {
+		return blockHash, NewBlockExists(blockHash)
+	}
+	if _, ok := s.sideBlocks[blockHash]; ok {
+		return blockHash, NewBlockExists(blockHash)
+	}
+
+	if b.Header.Parent != s.latestBlockHash {
+		return blockHash, s.addSideBlock(blockHash, b)
+	}
 
-	blockFSJSON, err := json.Marshal(blockFS)
-	if err != nil {
+	pendingState := s.copy()
+
+	if err := applyBlock(b, &pendingState); err != nil {
 		return Hash{}, err
 	}
 
-	fmt.Println("Persisting new Block to disk:")
-	fmt.Printf("\t%s\n", blockFSJSON)
-	if _, err := s.db.Write(append(blockFSJSON, '\n')); err != nil {
+	if err := s.persistBlock(BlockFS{blockHash, b}); err != nil {
 		return Hash{}, err
 	}
 
-	s.balances = pendingState.balances
-	s.latestBlockHash = blockHash
-	s.latestBlock = b
-	s.hasGenesisBlock = true
+	s.commit(pendingState)
+
+	if s.snapshotInterval > 0 && b.Header.Height > 0 && b.Header.Height%s.snapshotInterval == 0 {
+		if _, err := s.Snapshot(); err != nil {
+			fmt.Fprintln(os.Stderr, "error snapshotting state:", err)
+		}
+
+		if err := s.prune(); err != nil {
+			fmt.Fprintln(os.Stderr, "error pruning blocks:", err)
+		}
+	}
 
 	return blockHash, nil
 }
@@ -144,6 +247,11 @@ func (s *State) LatestBlockHash() Hash {
 	return s.latestBlockHash
 }
 
+// ChainWork returns the total work of the main chain.
+func (s *State) ChainWork() uint64 {
+	return s.chainWork
+}
+
 func (s *State) NextBlockHeight() uint64 {
 	if !s.hasGenesisBlock {
 		return uint64(0)
@@ -156,8 +264,13 @@ func (s *State) Balances() map[common.Address]uint64 {
 	return s.balances
 }
 
+// GetNextAccountNonce returns the nonce of the account's next transaction.
+func (s *State) GetNextAccountNonce(account common.Address) uint64 {
+	return s.accountNonces[account] + 1
+}
+
 func (s *State) Close() error {
-	return s.db.Close()
+	return s.store.Close()
 }
 
 func (s *State) copy() State {
@@ -165,51 +278,221 @@ func (s *State) copy() State {
 	c.latestBlock = s.latestBlock
 	c.latestBlockHash = s.latestBlockHash
 	c.hasGenesisBlock = s.hasGenesisBlock
+	c.chainID = s.chainID
+	c.genesisTime = s.genesisTime
+	c.params = s.params
+	c.periodStart = s.periodStart
+	c.recentTimes = slices.Clone(s.recentTimes)
+	c.chainWork = s.chainWork
+	c.store = s.store
 	c.balances = make(map[common.Address]uint64)
+	c.accountNonces = make(map[common.Address]uint64)
 
 	maps.Copy(c.balances, s.balances)
+	maps.Copy(c.accountNonces, s.accountNonces)
+	c.stateTree = s.stateTree
 
 	return c
 }
 
+// commit replaces the chain tip and balances with those of a pending state.
+func (s *State) commit(pending State) {
+	s.balances = pending.balances
+	s.accountNonces = pending.accountNonces
+	s.stateTree = pending.stateTree
+	s.latestBlock = pending.latestBlock
+	s.latestBlockHash = pending.latestBlockHash
+	s.hasGenesisBlock = pending.hasGenesisBlock
+	s.periodStart = pending.periodStart
+	s.recentTimes = pending.recentTimes
+	s.chainWork = pending.chainWork
+}
+
+func (s *State) persistBlock(blockFS BlockFS) error {
+	if err := s.store.AppendBlock(blockFS); err != nil {
+		return err
+	}
+
+	return s.indexBlock(blockFS)
+}
+
+// indexBlock adds a main chain block to the indexes.
+func (s *State) indexBlock(blockFS BlockFS) error {
+	if err := s.indexTRXs(blockFS); err != nil {
+		return err
+	}
+	if err := s.indexHistory(blockFS); err != nil {
+		return err
+	}
+	return s.putIndexMark(indexMark{blockFS.Value.Header.Height + 1, blockFS.Key})
+}
+
+// unindexBlocks drops the blocks from height 'length' onwards from the
+// indexes. The mark is lowered first so an interruption is redone on boot.
+func (s *State) unindexBlocks(length uint64) error {
+	mark := indexMark{Length: length}
+	if length > 0 {
+		blockFS, err := s.store.BlockByHeight(length - 1)
+		if err != nil {
+			return err
+		}
+		mark.Hash = blockFS.Key
+	}
+	if err := s.putIndexMark(mark); err != nil {
+		return err
+	}
+
+	for height := length; height < s.store.Len(); height++ {
+		blockFS, err := s.store.BlockByHeight(height)
+		if err != nil {
+			return err
+		}
+		if err := s.unindexTRXs(blockFS); err != nil {
+			return err
+		}
+		if err := s.unindexHistory(blockFS); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// updateIndexes indexes the stored blocks appended after the index mark.
+func (s *State) updateIndexes() error {
+	indexed, err := s.indexedLength()
+	if err != nil {
+		return err
+	}
+
+	for height := indexed; height < s.store.Len(); height++ {
+		blockFS, err := s.store.BlockByHeight(height)
+		if err != nil {
+			return err
+		}
+		if err := s.indexBlock(blockFS); err != nil {
+			return fmt.Errorf("indexing block at height %d: %w", height, err)
+		}
+	}
+
+	return nil
+}
+
+// indexedLength returns the number of stored blocks the index mark covers.
+func (s *State) indexedLength() (uint64, error) {
+	markJSON, err := s.store.GetState(indexMarkKey)
+	var notFound ErrStateNotFound
+	if errors.As(err, &notFound) {
+		return s.store.Base(), nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var mark indexMark
+	if err := json.Unmarshal(markJSON, &mark); err != nil {
+		return 0, err
+	}
+	if mark.Length <= s.store.Base() || mark.Length > s.store.Len() {
+		return s.store.Base(), nil
+	}
+
+	blockFS, err := s.store.BlockByHeight(mark.Length - 1)
+	if err != nil {
+		return 0, err
+	}
+	if blockFS.Key != mark.Hash {
+		return s.store.Base(), nil
+	}
+
+	return mark.Length, nil
+}
+
+func (s *State) putIndexMark(mark indexMark) error {
+	markJSON, err := json.Marshal(mark)
+	if err != nil {
+		return err
+	}
+	return s.store.PutState(indexMarkKey, markJSON)
+}
+
 func applyBlock(b Block, s *State) error {
-	if s.hasGenesisBlock && b.Header.Height != s.NextBlockHeight() {
+	if b.Header.Height != s.NextBlockHeight() {
 		return fmt.Errorf("next expected block height must be '%d' not '%d'",
 			s.NextBlockHeight(),
 			b.Header.Height,
 		)
 	}
 
-	if s.hasGenesisBlock &&
-		s.latestBlock.Header.Height > 0 &&
-		!reflect.DeepEqual(
-			b.Header.Parent, s.latestBlockHash,
-		) {
+	if !reflect.DeepEqual(b.Header.Parent, s.latestBlockHash) {
 		return fmt.Errorf("next block parent hash must be '%x' not '%x'",
 			s.latestBlockHash, b.Header.Parent,
 		)
 	}
 
+	if b.Header.Difficulty != s.NextBlockDifficulty() {
+		return fmt.Errorf("next block difficulty must be '%d' not '%d'",
+			s.NextBlockDifficulty(),
+			b.Header.Difficulty,
+		)
+	}
+
+	if err := s.validateTimes(b); err != nil {
+		return err
+	}
+
+	if err := b.checkLimits(); err != nil {
+		return err
+	}
+
 	hash, err := b.Hash()
 	if err != nil {
 		return err
 	}
 
-	if !hash.IsValid() {
-		return fmt.Errorf("invalid block hash %x", hash)
+	if err := b.verifyTrxRoot(); err != nil {
+		return err
+	}
+
+	if !hash.MeetsDifficulty(b.Header.Difficulty) {
+		return fmt.Errorf("block hash %x doesn't meet difficulty %d", hash, b.Header.Difficulty)
+	}
+
+	if err := applyBlockTRXs(b, s); err != nil {
+		return err
+	}
+
+	if stateRoot := s.StateRoot(); stateRoot != b.Header.StateRoot {
+		return fmt.Errorf("block state root must be '%x' not '%x'", stateRoot, b.Header.StateRoot)
+	}
+
+	s.latestBlock = b
+	s.latestBlockHash = hash
+	s.hasGenesisBlock = true
+	s.chainWork = addWork(s.chainWork, b.Work())
+	s.trackTime(b.Header.Time)
+
+	if s.params.RetargetInterval > 0 && b.Header.Height%s.params.RetargetInterval == 0 {
+		s.periodStart = b.Header.Time
 	}
 
+	return nil
+}
+
+// applyBlockTRXs applies the block transactions and pays the miner.
+func applyBlockTRXs(b Block, s *State) error {
 	if err := applyTRXs(b.TRXs, s); err != nil {
 		return err
 	}
 
-	s.balances[b.Header.Miner] += BlockReward
+	s.balances[b.Header.Miner] += b.Reward()
+	s.updateStateLeaf(b.Header.Miner)
 
 	return nil
 }
 
 func applyTrx(trx SignedTrx, s *State) error {
-	ok, err := trx.IsAuthentic()
+	ok, err := trx.IsAuthentic(s.chainID)
 	if err != nil {
 		return err
 	}
@@ -227,25 +510,31 @@ func applyTrx(trx SignedTrx, s *State) error {
 		return NewInvalidTransaction("Value")
 	}
 
-	if trx.Value > s.balances[trx.From] {
+	expectedNonce := s.GetNextAccountNonce(trx.From)
+	if trx.Nonce != expectedNonce {
+		return NewInvalidNonce(trx.From, expectedNonce, trx.Nonce)
+	}
+
+	if trx.Cost() < trx.Value || trx.Cost() > s.balances[trx.From] {
 		return new(ErrInsufficientBalance)
 	}
 
-	s.balances[trx.From] -= trx.Value
+	s.balances[trx.From] -= trx.Cost()
 	s.balances[trx.To] += trx.Value
+	s.accountNonces[trx.From] = trx.Nonce
+	s.updateStateLeaf(trx.From)
+	s.updateStateLeaf(trx.To)
 
 	return nil
 }
 
+// applyTRXs applies the transactions in block order.
 func applyTRXs(trxs []SignedTrx, s *State) error {
-	sort.Slice(trxs, func(i, j int) bool {
-		return trxs[i].Time < trxs[j].Time
-	})
-
-	for _, trx := range trxs {
+	for i, trx := range trxs {
 		err := applyTrx(trx, s)
 		if err != nil {
-			return err
+			trxHash, _ := trx.Hash()
+			return fmt.Errorf("transaction %d '%s': %w", i, trxHash.Hex(), err)
 		}
 	}
 
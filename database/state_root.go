@@ -0,0 +1,235 @@
+package database
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// stateTreeDepth gives the state tree one level per address bit.
+const stateTreeDepth = common.AddressLength * 8
+
+// emptyStateHashes[h] is the hash of an empty state subtree of height h.
+var emptyStateHashes = func() [stateTreeDepth + 1]Hash {
+	var hashes [stateTreeDepth + 1]Hash
+	for h := 1; h <= stateTreeDepth; h++ {
+		hashes[h] = merkleNodeHash(hashes[h-1], hashes[h-1])
+	}
+	return hashes
+}()
+
+type (
+	// StateProof proves an account's balance and nonce against a state
+	// root. An account without balance nor nonce is proven absent.
+	StateProof struct {
+		Account common.Address `json:"account"`
+		Balance uint64         `json:"balance"`
+		Nonce   uint64         `json:"nonce"`
+		// Siblings holds the non-empty sibling hashes by tree depth.
+		Siblings map[uint8]Hash `json:"siblings"`
+	}
+
+	stateLeaf struct {
+		account common.Address
+		hash    Hash
+	}
+
+	// stateNode is an immutable node of the state tree, shared by state
+	// copies. nil is an empty subtree.
+	stateNode struct {
+		hash        Hash
+		left, right *stateNode
+	}
+)
+
+// StateRoot computes the sparse Merkle root over the non-empty accounts.
+func StateRoot(balances, nonces map[common.Address]uint64) Hash {
+	return newStateTree(balances, nonces).root(0)
+}
+
+// VerifyStateProof reports whether the proof leads to root.
+func VerifyStateProof(root Hash, proof StateProof) bool {
+	hash := emptyStateHashes[0]
+	if proof.Balance != 0 || proof.Nonce != 0 {
+		hash = stateLeafHash(proof.Account, proof.Balance, proof.Nonce)
+	}
+
+	for depth := stateTreeDepth - 1; depth >= 0; depth-- {
+		sibling, ok := proof.Siblings[uint8(depth)]
+		if !ok {
+			sibling = emptyStateHashes[stateTreeDepth-depth-1]
+		}
+
+		if addressBit(proof.Account, depth) == 0 {
+			hash = merkleNodeHash(hash, sibling)
+		} else {
+			hash = merkleNodeHash(sibling, hash)
+		}
+	}
+
+	return hash == root
+}
+
+// StateRoot returns the root committing to the current balances and nonces.
+func (s *State) StateRoot() Hash {
+	return s.stateTree.root(0)
+}
+
+// PendingStateRoot returns the state root of the next block mined by miner
+// with the transactions.
+func (s *State) PendingStateRoot(miner common.Address, trxs []SignedTrx) (Hash, error) {
+	pendingState := s.copy()
+
+	b := Block{Header: BlockHeader{Miner: miner}, TRXs: trxs}
+	if err := applyBlockTRXs(b, &pendingState); err != nil {
+		return Hash{}, err
+	}
+
+	return pendingState.StateRoot(), nil
+}
+
+// BalanceProof proves the account's balance and nonce against StateRoot.
+func (s *State) BalanceProof(account common.Address) StateProof {
+	proof := StateProof{
+		Account:  account,
+		Balance:  s.balances[account],
+		Nonce:    s.accountNonces[account],
+		Siblings: make(map[uint8]Hash),
+	}
+
+	n := s.stateTree
+	for depth := 0; depth < stateTreeDepth && n != nil; depth++ {
+		next, sibling := n.left, n.right
+		if addressBit(account, depth) == 1 {
+			next, sibling = n.right, n.left
+		}
+
+		if sibling != nil {
+			proof.Siblings[uint8(depth)] = sibling.hash
+		}
+		n = next
+	}
+
+	return proof
+}
+
+// updateStateLeaf rehashes the account's leaf.
+func (s *State) updateStateLeaf(account common.Address) {
+	var leaf *Hash
+	if balance, nonce := s.balances[account], s.accountNonces[account]; balance != 0 || nonce != 0 {
+		hash := stateLeafHash(account, balance, nonce)
+		leaf = &hash
+	}
+
+	s.stateTree = s.stateTree.setLeaf(account, 0, leaf)
+}
+
+// newStateTree builds the state tree over the accounts' balances and nonces.
+func newStateTree(balances, nonces map[common.Address]uint64) *stateNode {
+	return buildStateTree(stateLeaves(balances, nonces), 0)
+}
+
+// stateLeaves returns the leaves of the non-empty accounts by address.
+func stateLeaves(balances, nonces map[common.Address]uint64) []stateLeaf {
+	accounts := make(map[common.Address]struct{})
+	for account, balance := range balances {
+		if balance != 0 {
+			accounts[account] = struct{}{}
+		}
+	}
+	for account, nonce := range nonces {
+		if nonce != 0 {
+			accounts[account] = struct{}{}
+		}
+	}
+
+	leaves := make([]stateLeaf, 0, len(accounts))
+	for account := range accounts {
+		leaves = append(leaves, stateLeaf{account, stateLeafHash(account, balances[account], nonces[account])})
+	}
+	sort.Slice(leaves, func(i, j int) bool {
+		return bytes.Compare(leaves[i].account[:], leaves[j].account[:]) < 0
+	})
+
+	return leaves
+}
+
+func buildStateTree(leaves []stateLeaf, depth int) *stateNode {
+	if len(leaves) == 0 {
+		return nil
+	}
+	if depth == stateTreeDepth {
+		return &stateNode{hash: leaves[0].hash}
+	}
+
+	left, right := splitStateLeaves(leaves, depth)
+
+	return newStateNode(buildStateTree(left, depth+1), buildStateTree(right, depth+1), depth)
+}
+
+func newStateNode(left, right *stateNode, depth int) *stateNode {
+	if left == nil && right == nil {
+		return nil
+	}
+	return &stateNode{
+		hash:  merkleNodeHash(left.root(depth+1), right.root(depth+1)),
+		left:  left,
+		right: right,
+	}
+}
+
+// root returns the hash of the subtree rooted at depth.
+func (n *stateNode) root(depth int) Hash {
+	if n == nil {
+		return emptyStateHashes[stateTreeDepth-depth]
+	}
+	return n.hash
+}
+
+// setLeaf returns a copy of the subtree with the account's leaf replaced.
+func (n *stateNode) setLeaf(account common.Address, depth int, leaf *Hash) *stateNode {
+	if depth == stateTreeDepth {
+		if leaf == nil {
+			return nil
+		}
+		return &stateNode{hash: *leaf}
+	}
+
+	var left, right *stateNode
+	if n != nil {
+		left, right = n.left, n.right
+	}
+
+	if addressBit(account, depth) == 0 {
+		left = left.setLeaf(account, depth+1, leaf)
+	} else {
+		right = right.setLeaf(account, depth+1, leaf)
+	}
+
+	return newStateNode(left, right, depth)
+}
+
+// splitStateLeaves splits sorted leaves on the address bit at depth.
+func splitStateLeaves(leaves []stateLeaf, depth int) (left, right []stateLeaf) {
+	i := sort.Search(len(leaves), func(i int) bool {
+		return addressBit(leaves[i].account, depth) == 1
+	})
+	return leaves[:i], leaves[i:]
+}
+
+func stateLeafHash(account common.Address, balance, nonce uint64) Hash {
+	data := make([]byte, 0, 1+common.AddressLength+16)
+	data = append(data, merkleLeafPrefix)
+	data = append(data, account[:]...)
+	data = binary.BigEndian.AppendUint64(data, balance)
+	data = binary.BigEndian.AppendUint64(data, nonce)
+	return sha256.Sum256(data)
+}
+
+// addressBit returns the address bit at depth, most significant first.
+func addressBit(account common.Address, depth int) byte {
+	return account[depth/8] >> (7 - depth%8) & 1
+}
@@ -0,0 +1,51 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestBalanceProof(t *testing.T) {
+	andrej := common.HexToAddress("0x3eb92807f1f91a8d4d85bc908c7f86dcddb1df57")
+	babayaga := common.HexToAddress("0x6fdc0d8d15ae6b4ebf45c52fd2aafbcbb19a65c8")
+	caesar := common.HexToAddress("0x22ba1F80452E6220c7cc6ea2D1e3EEDDaC5F694A")
+	stranger := common.HexToAddress("0x0000000000000000000000000000000000000001")
+
+	s := &State{
+		balances:      map[common.Address]uint64{andrej: 100, babayaga: 7, caesar: 0},
+		accountNonces: map[common.Address]uint64{andrej: 2},
+	}
+	s.stateTree = newStateTree(s.balances, s.accountNonces)
+	root := s.StateRoot()
+
+	if root != StateRoot(map[common.Address]uint64{andrej: 100, babayaga: 7}, map[common.Address]uint64{andrej: 2}) {
+		t.Errorf("accounts without balance nor nonce should not change the state root")
+	}
+
+	for _, account := range []common.Address{andrej, babayaga, caesar, stranger} {
+		proof := s.BalanceProof(account)
+		if !VerifyStateProof(root, proof) {
+			t.Errorf("proof of %s should verify", account.Hex())
+		}
+
+		proof.Balance++
+		if VerifyStateProof(root, proof) {
+			t.Errorf("proof of %s should not verify with a forged balance", account.Hex())
+		}
+	}
+
+	proof := s.BalanceProof(andrej)
+	if proof.Balance != 100 || proof.Nonce != 2 {
+		t.Errorf("proof should carry andrej's balance 100 and nonce 2 not %d and %d", proof.Balance, proof.Nonce)
+	}
+
+	s.balances[babayaga]++
+	s.updateStateLeaf(babayaga)
+	if s.StateRoot() != StateRoot(s.balances, s.accountNonces) {
+		t.Errorf("updating a leaf should give the root of the whole tree")
+	}
+	if VerifyStateProof(s.StateRoot(), proof) {
+		t.Errorf("proof should not verify against the root of another state")
+	}
+}
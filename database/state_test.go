@@ -0,0 +1,416 @@
+package database
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestNewStateFromDisk_RestoresSnapshot(t *testing.T) {
+	dataDir := setupTestDataDir(t)
+
+	store, err := openStorage(dataDir, options{engine: EngineFile})
+	if err != nil {
+		t.Fatalf("error opening storage: %v", err)
+	}
+
+	// The blocks carry no valid PoW so the State can only be loaded
+	// without replaying them, i.e. from the snapshot.
+	var latest BlockFS
+	for height := uint64(0); height < 3; height++ {
+		latest = BlockFS{Key: Hash{byte(height + 1)}, Value: Block{Header: BlockHeader{Height: height}}}
+		if err := store.AppendBlock(latest); err != nil {
+			t.Fatalf("error appending block: %v", err)
+		}
+	}
+
+	acc := common.HexToAddress("0x3eb92807f1f91a8d4d85bc908c7f86dcddb1df57")
+	s := &State{
+		balances:        map[common.Address]uint64{acc: 42},
+		latestBlock:     latest.Value,
+		latestBlockHash: latest.Key,
+		hasGenesisBlock: true,
+		store:           store,
+	}
+
+	if _, err := s.Snapshot(); err != nil {
+		t.Fatalf("error creating snapshot: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("error closing state: %v", err)
+	}
+
+	restored, err := NewStateFromDisk(dataDir)
+	if err != nil {
+		t.Fatalf("error loading state from snapshot: %v", err)
+	}
+	defer restored.Close()
+
+	if restored.LatestBlockHash() != latest.Key {
+		t.Errorf("latest block hash should be %s not %s", latest.Key.Hex(), restored.LatestBlockHash().Hex())
+	}
+	if restored.Balances()[acc] != 42 {
+		t.Errorf("balance should be restored as 42 not %d", restored.Balances()[acc])
+	}
+}
+
+func TestLatestSnapshot_SkipsStaleSnapshot(t *testing.T) {
+	dataDir := setupTestDataDir(t)
+
+	store, err := openStorage(dataDir, options{engine: EngineFile})
+	if err != nil {
+		t.Fatalf("error opening storage: %v", err)
+	}
+
+	s := &State{
+		balances:        map[common.Address]uint64{},
+		latestBlock:     Block{Header: BlockHeader{Height: 0}},
+		latestBlockHash: Hash{1},
+		hasGenesisBlock: true,
+		store:           store,
+	}
+	defer s.Close()
+
+	if err := store.AppendBlock(BlockFS{Key: Hash{2}, Value: Block{}}); err != nil {
+		t.Fatalf("error appending block: %v", err)
+	}
+
+	if _, err := s.Snapshot(); err != nil {
+		t.Fatalf("error creating snapshot: %v", err)
+	}
+
+	_, ok, err := s.latestSnapshot(s.store.Len())
+	if err != nil {
+		t.Fatalf("error looking up snapshot: %v", err)
+	}
+	if ok {
+		t.Errorf("snapshot of a block hash not in storage should be skipped")
+	}
+}
+
+// testGenesisJSON keeps the difficulty low so test blocks mine instantly.
+const testGenesisJSON = `{"chain_id": "tbb-test", "difficulty": 16, "retarget_interval": 0, "balances": {}}`
+
+func TestAddBlock_ReorganizesToHeavierChain(t *testing.T) {
+	dataDir := setupTestDataDirWithGenesis(t, testGenesisJSON)
+
+	s, err := NewStateFromDisk(dataDir)
+	if err != nil {
+		t.Fatalf("error creating state: %v", err)
+	}
+
+	andrej := common.HexToAddress("0x3eb92807f1f91a8d4d85bc908c7f86dcddb1df57")
+	babayaga := common.HexToAddress("0x6fdc0d8d15ae6b4ebf45c52fd2aafbcbb19a65c8")
+
+	a0 := mineTestBlock(t, Hash{}, 0, 16, andrej, map[common.Address]uint64{andrej: BlockReward})
+	a0Hash := addTestBlock(t, s, a0)
+	a1 := mineTestBlock(t, a0Hash, 1, 16, andrej, map[common.Address]uint64{andrej: 2 * BlockReward})
+	addTestBlock(t, s, a1)
+
+	b1 := mineTestBlock(t, a0Hash, 1, 16, babayaga, map[common.Address]uint64{andrej: BlockReward, babayaga: BlockReward})
+	b1Hash := addTestBlock(t, s, b1)
+	if s.LatestBlock().Header.Miner != andrej {
+		t.Fatalf("a side chain of equal work should not replace the main chain")
+	}
+
+	b2 := mineTestBlock(t, b1Hash, 2, 16, babayaga, map[common.Address]uint64{andrej: BlockReward, babayaga: 2 * BlockReward})
+	b2Hash := addTestBlock(t, s, b2)
+
+	assertReorganized := func(s *State) {
+		t.Helper()
+
+		if s.LatestBlockHash() != b2Hash {
+			t.Fatalf("latest block should be %s not %s", b2Hash.Hex(), s.LatestBlockHash().Hex())
+		}
+		if s.Balances()[andrej] != BlockReward {
+			t.Errorf("andrej should keep only the common block reward, has %d", s.Balances()[andrej])
+		}
+		if s.Balances()[babayaga] != 2*BlockReward {
+			t.Errorf("babayaga should earn both side chain block rewards, has %d", s.Balances()[babayaga])
+		}
+
+		blockFS, err := s.GetBlockByHeight(1)
+		if err != nil {
+			t.Fatalf("error reading block at height 1: %v", err)
+		}
+		if blockFS.Key != b1Hash {
+			t.Errorf("stored block at height 1 should be %s not %s", b1Hash.Hex(), blockFS.Key.Hex())
+		}
+	}
+
+	assertReorganized(s)
+
+	var exists ErrBlockExists
+	if _, err := s.AddBlock(a1); !errors.As(err, &exists) {
+		t.Errorf("replaced block should be tracked as a known side block, got: %v", err)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatalf("error closing state: %v", err)
+	}
+
+	reloaded, err := NewStateFromDisk(dataDir)
+	if err != nil {
+		t.Fatalf("error reloading state: %v", err)
+	}
+	defer reloaded.Close()
+
+	assertReorganized(reloaded)
+}
+
+func TestAddBlock_RestoresChainWhenReorganizationFails(t *testing.T) {
+	privKey, from := generateTestKey(t)
+	andrej := common.HexToAddress("0x3eb92807f1f91a8d4d85bc908c7f86dcddb1df57")
+	babayaga := common.HexToAddress("0x6fdc0d8d15ae6b4ebf45c52fd2aafbcbb19a65c8")
+
+	dataDir := setupTestDataDirWithGenesis(t, fmt.Sprintf(
+		`{"chain_id": "", "difficulty": 16, "retarget_interval": 0, "balances": {"%s": 1000}}`, from.Hex()))
+
+	s, err := NewStateFromDisk(dataDir)
+	if err != nil {
+		t.Fatalf("error creating state: %v", err)
+	}
+	defer s.Close()
+
+	a0 := mineTestBlock(t, Hash{}, 0, 16, andrej, map[common.Address]uint64{from: 1000, andrej: BlockReward})
+	a0Hash := addTestBlock(t, s, a0)
+
+	trx := signTestTrx(t, privKey, NewTrx(from, babayaga, 10, 1, 1, ""))
+	trxHash, err := trx.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stateRoot, err := s.PendingStateRoot(andrej, []SignedTrx{trx})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a1 := NewBlock(a0Hash, 1, 16, 0, uint64(time.Now().UnixNano()), andrej, stateRoot, []SignedTrx{trx})
+	if _, err := a1.seal(); err != nil {
+		t.Fatal(err)
+	}
+	a1Hash := addTestBlock(t, s, a1)
+
+	sideBalances := func(blocks uint64) map[common.Address]uint64 {
+		return map[common.Address]uint64{from: 1000, andrej: BlockReward, babayaga: blocks * BlockReward}
+	}
+	b1Hash := addTestBlock(t, s, mineTestBlock(t, a0Hash, 1, 16, babayaga, sideBalances(1)))
+	b2 := mineTestBlock(t, b1Hash, 2, 16, babayaga, sideBalances(2))
+
+	store := s.store
+	s.store = &failingStorage{Storage: store, failAppend: 2}
+	if _, err := s.AddBlock(b2); err == nil {
+		t.Fatalf("expected the reorganization to fail")
+	}
+	s.store = store
+
+	if s.LatestBlockHash() != a1Hash {
+		t.Errorf("latest block should still be %s not %s", a1Hash.Hex(), s.LatestBlockHash().Hex())
+	}
+	if blockFS, err := s.GetBlockByHeight(1); err != nil || blockFS.Key != a1Hash {
+		t.Errorf("the replaced block should be stored again at height 1, got %s: %v", blockFS.Key.Hex(), err)
+	}
+	if s.store.Len() != 2 {
+		t.Errorf("2 blocks should be stored not %d", s.store.Len())
+	}
+	if _, location, err := s.GetTrx(trxHash); err != nil || location.BlockHash != a1Hash {
+		t.Errorf("the transaction should still be indexed in %s, got %+v: %v", a1Hash.Hex(), location, err)
+	}
+	if orphaned := s.TakeOrphanedTRXs(); len(orphaned) != 0 {
+		t.Errorf("a failed reorganization shouldn't orphan transactions, got %d", len(orphaned))
+	}
+
+	b2Hash, err := b2.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	addTestBlock(t, s, mineTestBlock(t, b2Hash, 3, 16, babayaga, sideBalances(3)))
+
+	if s.LatestBlock().Header.Height != 3 {
+		t.Fatalf("the side chain should replace the main chain")
+	}
+	orphaned := s.TakeOrphanedTRXs()
+	if len(orphaned) != 1 || orphaned[0].Nonce != trx.Nonce || orphaned[0].From != from {
+		t.Errorf("the transaction of the replaced block should be orphaned, got %v", orphaned)
+	}
+	if orphaned := s.TakeOrphanedTRXs(); len(orphaned) != 0 {
+		t.Errorf("orphaned transactions should be taken once, got %d again", len(orphaned))
+	}
+}
+
+// failingStorage fails the failAppend-th block append.
+type failingStorage struct {
+	Storage
+	failAppend int
+}
+
+func (f *failingStorage) AppendBlock(blockFS BlockFS) error {
+	f.failAppend--
+	if f.failAppend == 0 {
+		return errors.New("disk full")
+	}
+	return f.Storage.AppendBlock(blockFS)
+}
+
+func TestAddBlock_RejectsCheapSideBlocks(t *testing.T) {
+	dataDir := setupTestDataDirWithGenesis(t, testGenesisJSON)
+
+	s, err := NewStateFromDisk(dataDir)
+	if err != nil {
+		t.Fatalf("error creating state: %v", err)
+	}
+	defer s.Close()
+
+	andrej := common.HexToAddress("0x3eb92807f1f91a8d4d85bc908c7f86dcddb1df57")
+	babayaga := common.HexToAddress("0x6fdc0d8d15ae6b4ebf45c52fd2aafbcbb19a65c8")
+
+	a0 := mineTestBlock(t, Hash{}, 0, 16, andrej, map[common.Address]uint64{andrej: BlockReward})
+	a0Hash := addTestBlock(t, s, a0)
+	addTestBlock(t, s, mineTestBlock(t, a0Hash, 1, 16, andrej, map[common.Address]uint64{andrej: 2 * BlockReward}))
+
+	sideBalances := map[common.Address]uint64{andrej: BlockReward, babayaga: BlockReward}
+
+	cheap := mineTestBlock(t, a0Hash, 1, 1, babayaga, sideBalances)
+	if _, err := s.AddBlock(cheap); err == nil {
+		t.Errorf("expected a side block below the expected difficulty to be rejected")
+	}
+	if len(s.sideBlocks) != 0 {
+		t.Errorf("a rejected side block should not be tracked")
+	}
+
+	start := uint64(time.Now().UnixNano())
+	for i := range uint64(maxSideBlocks) {
+		addTestBlock(t, s, mineTestBlockAt(t, a0Hash, 1, 16, start+i, babayaga, sideBalances))
+	}
+	if _, err := s.AddBlock(mineTestBlockAt(t, a0Hash, 1, 16, start+maxSideBlocks, babayaga, sideBalances)); err == nil {
+		t.Errorf("expected side blocks beyond %d to be rejected", maxSideBlocks)
+	}
+}
+
+// mineTestBlock mines an empty block resulting in the given balances.
+func mineTestBlock(t *testing.T, parent Hash, height, difficulty uint64, miner common.Address, balances map[common.Address]uint64) Block {
+	t.Helper()
+
+	return mineTestBlockAt(t, parent, height, difficulty, uint64(time.Now().UnixNano()), miner, balances)
+}
+
+func mineTestBlockAt(t *testing.T, parent Hash, height, difficulty, blockTime uint64, miner common.Address, balances map[common.Address]uint64) Block {
+	t.Helper()
+
+	stateRoot := StateRoot(balances, nil)
+	for nonce := uint32(0); ; nonce++ {
+		b := NewBlock(parent, height, difficulty, nonce, blockTime, miner, stateRoot, []SignedTrx{})
+
+		hash, err := b.Hash()
+		if err != nil {
+			t.Fatalf("error hashing block: %v", err)
+		}
+		if hash.MeetsDifficulty(difficulty) {
+			return b
+		}
+	}
+}
+
+func addTestBlock(t *testing.T, s *State, b Block) Hash {
+	t.Helper()
+
+	hash, err := s.AddBlock(b)
+	if err != nil {
+		t.Fatalf("error adding block at height %d: %v", b.Header.Height, err)
+	}
+	return hash
+}
+
+func TestApplyTrx_RejectsReplayedNonce(t *testing.T) {
+	privKey, from := generateTestKey(t)
+	to := common.HexToAddress("0x6fdc0d8d15ae6b4ebf45c52fd2aafbcbb19a65c8")
+
+	s := &State{
+		balances:      map[common.Address]uint64{from: 10},
+		accountNonces: map[common.Address]uint64{},
+	}
+
+	trx := signTestTrx(t, privKey, NewTrx(from, to, 1, 0, 1, ""))
+
+	if err := applyTrx(trx, s); err != nil {
+		t.Fatalf("error applying transaction: %v", err)
+	}
+	if s.GetNextAccountNonce(from) != 2 {
+		t.Errorf("next nonce should be 2 not %d", s.GetNextAccountNonce(from))
+	}
+
+	var invalidNonce ErrInvalidNonce
+	if err := applyTrx(trx, s); !errors.As(err, &invalidNonce) {
+		t.Fatalf("expected replayed transaction to be rejected with an invalid nonce, got: %v", err)
+	}
+
+	skipped := signTestTrx(t, privKey, NewTrx(from, to, 1, 0, 3, ""))
+	if err := applyTrx(skipped, s); !errors.As(err, &invalidNonce) {
+		t.Fatalf("expected transaction skipping a nonce to be rejected, got: %v", err)
+	}
+
+	if s.balances[from] != 9 || s.balances[to] != 1 {
+		t.Errorf("only the first transaction should be applied, balances: %v", s.balances)
+	}
+}
+
+func TestApplyTrx_ChargesFee(t *testing.T) {
+	privKey, from := generateTestKey(t)
+	to := common.HexToAddress("0x6fdc0d8d15ae6b4ebf45c52fd2aafbcbb19a65c8")
+
+	s := &State{
+		balances:      map[common.Address]uint64{from: 10},
+		accountNonces: map[common.Address]uint64{},
+	}
+
+	tooExpensive := signTestTrx(t, privKey, NewTrx(from, to, 8, 3, 1, ""))
+	var insufficientBalance *ErrInsufficientBalance
+	if err := applyTrx(tooExpensive, s); !errors.As(err, &insufficientBalance) {
+		t.Fatalf("expected a transaction whose value and fee exceed the balance to be rejected, got: %v", err)
+	}
+
+	trx := signTestTrx(t, privKey, NewTrx(from, to, 5, 2, 1, ""))
+	if err := applyTrx(trx, s); err != nil {
+		t.Fatalf("error applying transaction: %v", err)
+	}
+
+	if s.balances[from] != 3 || s.balances[to] != 5 {
+		t.Errorf("sender should pay value and fee, balances: %v", s.balances)
+	}
+
+	b := NewBlock(Hash{}, 0, 0, 0, 0, common.Address{}, Hash{}, []SignedTrx{trx})
+	if b.Reward() != BlockReward+2 {
+		t.Errorf("block reward should be %d not %d", BlockReward+2, b.Reward())
+	}
+}
+
+func generateTestKey(t *testing.T) (*ecdsa.PrivateKey, common.Address) {
+	t.Helper()
+
+	privKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("error generating key: %v", err)
+	}
+
+	return privKey, crypto.PubkeyToAddress(privKey.PublicKey)
+}
+
+func signTestTrx(t *testing.T, privKey *ecdsa.PrivateKey, trx Trx) SignedTrx {
+	t.Helper()
+
+	trxHash, err := trx.SigningHash("")
+	if err != nil {
+		t.Fatalf("error hashing transaction: %v", err)
+	}
+
+	sig, err := crypto.Sign(trxHash[:], privKey)
+	if err != nil {
+		t.Fatalf("error signing transaction: %v", err)
+	}
+
+	return NewSignedTrx(trx, sig)
+}
@@ -0,0 +1,114 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/marc-watters/the-block-chain-bar/v2/fs"
+)
+
+const (
+	EngineFile    = "file"
+	EngineLevelDB = "leveldb"
+
+	// SyncAlways flushes every appended block, SyncNever leaves it to the OS.
+	SyncAlways = "always"
+	SyncNever  = "never"
+)
+
+// Storage persists the blocks, block indexes and state a State is built
+// from. Reading a pruned block fails with ErrBlockPruned.
+type Storage interface {
+	AppendBlock(BlockFS) error
+	BlockByHeight(height uint64) (BlockFS, error)
+	BlockHeight(hash Hash) (uint64, bool)
+	Len() uint64
+	// Truncate drops every block from height 'length' onwards.
+	Truncate(length uint64) error
+	// Prune drops blocks below height 'base' and returns the new Base.
+	Prune(base uint64) (uint64, error)
+	// Base is the height of the first stored block.
+	Base() uint64
+
+	PutState(key string, value []byte) error
+	GetState(key string) ([]byte, error)
+	// DeleteState removes the state stored under key, if any.
+	DeleteState(key string) error
+
+	// Recovered reports the torn trailing record discarded on open.
+	Recovered() (Recovery, bool)
+	// Damaged reports the first record a read-only storage couldn't index.
+	Damaged() (Damage, bool)
+
+	Close() error
+}
+
+// Recovery describes a torn block record cut off the storage.
+type Recovery struct {
+	Offset    int64
+	Discarded []byte
+}
+
+// Damage describes the unreadable record of the block at Height.
+type Damage struct {
+	Height uint64
+	Reason string
+}
+
+// errReadOnlyStorage is returned for writes to a storage opened read-only.
+var errReadOnlyStorage = errors.New("storage is opened read-only")
+
+// DetectEngine reports the engine of a data directory, the file engine
+// for new ones.
+func DetectEngine(dataDir string) string {
+	if exists, _ := fs.DirExists(fs.GetLevelDBDirPath(dataDir)); exists {
+		return EngineLevelDB
+	}
+	return EngineFile
+}
+
+// hasFileBlocks reports whether the file engine stored any block.
+func hasFileBlocks(dataDir string) bool {
+	if exists, _ := fs.DirExists(fs.GetSegmentsDirPath(dataDir)); exists {
+		return true
+	}
+	info, err := fs.AppFS.Stat(fs.GetBlocksDBFilePath(dataDir))
+	return err == nil && info.Size() > 0
+}
+
+func openStorage(dataDir string, o options) (Storage, error) {
+	detected := DetectEngine(dataDir)
+	engine := o.engine
+	if engine == "" {
+		engine = detected
+	}
+	if engine != detected && (detected == EngineLevelDB || hasFileBlocks(dataDir)) {
+		return nil, fmt.Errorf("'%s' was created with the '%s' engine not '%s'", dataDir, detected, engine)
+	}
+
+	var sync bool
+	switch o.syncPolicy {
+	case SyncAlways, "":
+		sync = true
+	case SyncNever:
+		sync = false
+	default:
+		return nil, fmt.Errorf("unknown fsync policy '%s'", o.syncPolicy)
+	}
+
+	switch engine {
+	case EngineFile:
+		segmentSize := o.segmentSize
+		if segmentSize == 0 {
+			segmentSize = DefaultSegmentSize
+		}
+		if segmentSize < 0 {
+			return nil, fmt.Errorf("invalid segment size '%d'", segmentSize)
+		}
+		return openFileStorage(dataDir, sync, segmentSize, o.readOnly)
+	case EngineLevelDB:
+		return openLevelDBStorage(dataDir, sync, o.readOnly)
+	default:
+		return nil, fmt.Errorf("unknown database engine '%s'", engine)
+	}
+}
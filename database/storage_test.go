@@ -0,0 +1,399 @@
+package database
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/marc-watters/the-block-chain-bar/v2/fs"
+)
+
+func TestStorage(t *testing.T) {
+	for _, engine := range []string{EngineFile, EngineLevelDB} {
+		t.Run(engine, func(t *testing.T) {
+			dataDir := setupTestDataDir(t)
+
+			store, err := openStorage(dataDir, options{engine: engine})
+			if err != nil {
+				t.Fatalf("error opening storage: %v", err)
+			}
+
+			blocks := make([]BlockFS, 3)
+			for i := range blocks {
+				blocks[i] = BlockFS{Key: Hash{byte(i + 1)}, Value: Block{Header: BlockHeader{Height: uint64(i)}}}
+				if err := store.AppendBlock(blocks[i]); err != nil {
+					t.Fatalf("error appending block %d: %v", i, err)
+				}
+			}
+
+			if err := store.AppendBlock(BlockFS{Key: Hash{9}, Value: Block{Header: BlockHeader{Height: 5}}}); err == nil {
+				t.Errorf("expected appending a block out of height order to fail")
+			}
+
+			if err := store.PutState("balances", []byte(`{"a":1}`)); err != nil {
+				t.Fatalf("error putting state: %v", err)
+			}
+
+			if err := store.Close(); err != nil {
+				t.Fatalf("error closing storage: %v", err)
+			}
+
+			if got := DetectEngine(dataDir); got != engine {
+				t.Errorf("detected engine should be '%s' not '%s'", engine, got)
+			}
+
+			other := EngineLevelDB
+			if engine == EngineLevelDB {
+				other = EngineFile
+			}
+			if _, err := openStorage(dataDir, options{engine: other}); err == nil {
+				t.Errorf("expected opening a '%s' datadir with the '%s' engine to fail", engine, other)
+			}
+
+			store, err = openStorage(dataDir, options{engine: engine})
+			if err != nil {
+				t.Fatalf("error reopening storage: %v", err)
+			}
+			defer store.Close()
+
+			if store.Len() != uint64(len(blocks)) {
+				t.Fatalf("storage should hold %d blocks not %d", len(blocks), store.Len())
+			}
+
+			for _, want := range blocks {
+				height, ok := store.BlockHeight(want.Key)
+				if !ok || height != want.Value.Header.Height {
+					t.Fatalf("block %s should be indexed at height %d", want.Key.Hex(), want.Value.Header.Height)
+				}
+
+				got, err := store.BlockByHeight(height)
+				if err != nil {
+					t.Fatalf("error reading block at height %d: %v", height, err)
+				}
+				if got.Key != want.Key {
+					t.Errorf("block at height %d should have hash %s not %s", height, want.Key.Hex(), got.Key.Hex())
+				}
+			}
+
+			var notFound ErrBlockNotFound
+			if _, err := store.BlockByHeight(uint64(len(blocks))); !errors.As(err, &notFound) {
+				t.Errorf("expected block not found error, got: %v", err)
+			}
+
+			value, err := store.GetState("balances")
+			if err != nil {
+				t.Fatalf("error getting state: %v", err)
+			}
+			if !bytes.Equal(value, []byte(`{"a":1}`)) {
+				t.Errorf("unexpected state value: %s", value)
+			}
+
+			var stateNotFound ErrStateNotFound
+			if _, err := store.GetState("missing"); !errors.As(err, &stateNotFound) {
+				t.Errorf("expected state not found error, got: %v", err)
+			}
+
+			if err := store.Truncate(1); err != nil {
+				t.Fatalf("error truncating storage: %v", err)
+			}
+			if store.Len() != 1 {
+				t.Errorf("truncated storage should hold 1 block not %d", store.Len())
+			}
+			if _, ok := store.BlockHeight(blocks[2].Key); ok {
+				t.Errorf("truncated block %s should no longer be indexed", blocks[2].Key.Hex())
+			}
+
+			replacement := BlockFS{Key: Hash{7}, Value: Block{Header: BlockHeader{Height: 1}}}
+			if err := store.AppendBlock(replacement); err != nil {
+				t.Fatalf("error appending block after truncating: %v", err)
+			}
+			if got, err := store.BlockByHeight(1); err != nil || got.Key != replacement.Key {
+				t.Errorf("block at height 1 should be the replacement, got %s: %v", got.Key.Hex(), err)
+			}
+		})
+	}
+}
+
+func setupTestDataDir(t *testing.T) string {
+	t.Helper()
+
+	return setupTestDataDirWithGenesis(t, fs.GenesisJSON)
+}
+
+func setupTestDataDirWithGenesis(t *testing.T, genesisJSON string) string {
+	t.Helper()
+
+	dataDir, err := fs.AppFS.TempDir(os.TempDir(), "tbb_database_test")
+	if err != nil {
+		t.Fatalf("error creating test data directory: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := fs.RemoveDir(dataDir); err != nil {
+			fmt.Fprintf(os.Stderr, "error removing data directory: %v", err)
+		}
+	})
+
+	if err := fs.InitDataDirIfNotExists(dataDir, []byte(genesisJSON)); err != nil {
+		t.Fatalf("error initializing data directory: %v", err)
+	}
+
+	return dataDir
+}
+
+func TestFileStorage_DiscardsTornRecord(t *testing.T) {
+	dataDir := setupTestDataDir(t)
+
+	store, err := openStorage(dataDir, options{engine: EngineFile})
+	if err != nil {
+		t.Fatalf("error opening storage: %v", err)
+	}
+
+	for height := uint64(0); height < 2; height++ {
+		blockFS := BlockFS{Key: Hash{byte(height + 1)}, Value: Block{Header: BlockHeader{Height: height}}}
+		if err := store.AppendBlock(blockFS); err != nil {
+			t.Fatalf("error appending block: %v", err)
+		}
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("error closing storage: %v", err)
+	}
+
+	validSize, err := fileSize(fs.GetBlocksDBFilePath(dataDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate a crash in the middle of appending the third block.
+	record, err := BlockFS{Key: Hash{3}, Value: Block{Header: BlockHeader{Height: 2}}}.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	torn := record[:len(record)/2]
+	f, err := os.OpenFile(fs.GetBlocksDBFilePath(dataDir), os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write(torn); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	store, err = openStorage(dataDir, options{engine: EngineFile})
+	if err != nil {
+		t.Fatalf("error reopening storage with a torn record: %v", err)
+	}
+	defer store.Close()
+
+	recovery, ok := store.Recovered()
+	if !ok {
+		t.Fatal("expected the torn record to be reported")
+	}
+	if recovery.Offset != validSize || !bytes.Equal(recovery.Discarded, torn) {
+		t.Errorf("unexpected recovery report: offset %d, discarded %q", recovery.Offset, recovery.Discarded)
+	}
+
+	if store.Len() != 2 {
+		t.Errorf("storage should hold 2 blocks not %d", store.Len())
+	}
+
+	size, err := fileSize(fs.GetBlocksDBFilePath(dataDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != validSize {
+		t.Errorf("block.db should be truncated to %d bytes not %d", validSize, size)
+	}
+
+	if err := store.AppendBlock(BlockFS{Key: Hash{3}, Value: Block{Header: BlockHeader{Height: 2}}}); err != nil {
+		t.Fatalf("error appending block after recovery: %v", err)
+	}
+	if _, err := store.BlockByHeight(2); err != nil {
+		t.Errorf("error reading block appended after recovery: %v", err)
+	}
+}
+
+func fileSize(path string) (int64, error) {
+	info, err := fs.AppFS.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+func TestFileStorage_SealsSegments(t *testing.T) {
+	dataDir := setupTestDataDir(t)
+
+	testBlock := func(key byte, height uint64) BlockFS {
+		return BlockFS{Key: Hash{key}, Value: Block{Header: BlockHeader{Height: height}}}
+	}
+
+	// Records of these blocks all have the same size, so a segment is
+	// sealed every two blocks.
+	record, err := testBlock(1, 1).Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := options{engine: EngineFile, segmentSize: int64(2*len(record) - 1)}
+
+	store, err := openStorage(dataDir, o)
+	if err != nil {
+		t.Fatalf("error opening storage: %v", err)
+	}
+	for height := uint64(0); height < 5; height++ {
+		if err := store.AppendBlock(testBlock(byte(height+1), height)); err != nil {
+			t.Fatalf("error appending block %d: %v", height, err)
+		}
+	}
+
+	assertBlocks := func(store Storage, keys ...byte) {
+		t.Helper()
+
+		if store.Len() != uint64(len(keys)) {
+			t.Fatalf("storage should hold %d blocks not %d", len(keys), store.Len())
+		}
+		for height, key := range keys {
+			got, err := store.BlockByHeight(uint64(height))
+			if err != nil {
+				t.Fatalf("error reading block at height %d: %v", height, err)
+			}
+			if got.Key != (Hash{key}) {
+				t.Errorf("block at height %d should have hash %s not %s", height, Hash{key}.Hex(), got.Key.Hex())
+			}
+			if h, ok := store.BlockHeight(Hash{key}); !ok || h != uint64(height) {
+				t.Errorf("block %s should be indexed at height %d", Hash{key}.Hex(), height)
+			}
+		}
+	}
+	assertSegments := func(store Storage, n int) {
+		t.Helper()
+
+		if got := len(store.(*fileStorage).manifest.Segments); got != n {
+			t.Errorf("storage should have %d sealed segments not %d", n, got)
+		}
+	}
+
+	assertBlocks(store, 1, 2, 3, 4, 5)
+	assertSegments(store, 2)
+
+	if err := store.Close(); err != nil {
+		t.Fatalf("error closing storage: %v", err)
+	}
+
+	// The segment size of the manifest outlives the one asked for.
+	store, err = openStorage(dataDir, options{engine: EngineFile, segmentSize: 1})
+	if err != nil {
+		t.Fatalf("error reopening storage: %v", err)
+	}
+	assertBlocks(store, 1, 2, 3, 4, 5)
+	assertSegments(store, 2)
+
+	if err := store.Truncate(3); err != nil {
+		t.Fatalf("error truncating storage: %v", err)
+	}
+	assertBlocks(store, 1, 2, 3)
+	assertSegments(store, 1)
+
+	if err := store.AppendBlock(testBlock(9, 3)); err != nil {
+		t.Fatalf("error appending block after truncating: %v", err)
+	}
+	assertBlocks(store, 1, 2, 3, 9)
+	assertSegments(store, 2)
+
+	if err := store.Close(); err != nil {
+		t.Fatalf("error closing storage: %v", err)
+	}
+
+	store, err = openStorage(dataDir, o)
+	if err != nil {
+		t.Fatalf("error reopening storage: %v", err)
+	}
+	assertBlocks(store, 1, 2, 3, 9)
+	if err := store.Close(); err != nil {
+		t.Fatalf("error closing storage: %v", err)
+	}
+
+	segmentPath := filepath.Join(fs.GetSegmentsDirPath(dataDir), "000000000000.sz")
+	segment, err := fs.AppFS.ReadFile(segmentPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	segment[len(segment)-1] ^= 0xff
+	if err := fs.AppFS.WriteFile(segmentPath, segment, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := openStorage(dataDir, o); err == nil {
+		t.Errorf("expected opening storage with a corrupted segment to fail")
+	}
+}
+
+func TestFileStorage_ResumesInterruptedTruncation(t *testing.T) {
+	dataDir := setupTestDataDir(t)
+
+	testBlock := func(key byte, height uint64) BlockFS {
+		return BlockFS{Key: Hash{key}, Value: Block{Header: BlockHeader{Height: height}}}
+	}
+
+	record, err := testBlock(1, 1).Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := options{engine: EngineFile, segmentSize: int64(2*len(record) - 1)}
+
+	store, err := openStorage(dataDir, o)
+	if err != nil {
+		t.Fatalf("error opening storage: %v", err)
+	}
+	for height := uint64(0); height < 5; height++ {
+		if err := store.AppendBlock(testBlock(byte(height+1), height)); err != nil {
+			t.Fatalf("error appending block %d: %v", height, err)
+		}
+	}
+
+	// Truncating to 3 blocks is interrupted once the manifest dropped the
+	// second segment, before block.db holds the kept block of it.
+	if err := store.(*fileStorage).dropSegments(1, 3); err != nil {
+		t.Fatalf("error dropping segments: %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("error closing storage: %v", err)
+	}
+
+	readOnly := o
+	readOnly.readOnly = true
+	store, err = openStorage(dataDir, readOnly)
+	if err != nil {
+		t.Fatalf("error opening storage read-only: %v", err)
+	}
+	if damage, ok := store.Damaged(); !ok || damage.Height != 2 {
+		t.Errorf("the interrupted truncation should be reported as damage at height 2, got %+v", damage)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("error closing storage: %v", err)
+	}
+
+	store, err = openStorage(dataDir, o)
+	if err != nil {
+		t.Fatalf("error reopening storage: %v", err)
+	}
+	defer store.Close()
+
+	if store.Len() != 3 {
+		t.Fatalf("storage should hold 3 blocks not %d", store.Len())
+	}
+	for height := uint64(0); height < 3; height++ {
+		got, err := store.BlockByHeight(height)
+		if err != nil {
+			t.Fatalf("error reading block at height %d: %v", height, err)
+		}
+		if got.Key != (Hash{byte(height + 1)}) {
+			t.Errorf("block at height %d should have hash %s not %s", height, Hash{byte(height + 1)}.Hex(), got.Key.Hex())
+		}
+	}
+	if m := store.(*fileStorage).manifest; m.Unsealing != nil || len(m.Segments) != 1 {
+		t.Errorf("the truncation should be completed, got manifest %+v", m)
+	}
+}
@@ -0,0 +1,60 @@
+package database
+
+import (
+	"slices"
+	"time"
+)
+
+const (
+	// MaxFutureDrift tolerates clock skew between nodes.
+	MaxFutureDrift = 15 * time.Minute
+
+	// medianTimeSpan is the number of blocks of the median time past.
+	medianTimeSpan = 11
+)
+
+// MedianTimePast returns the time the next block must be timestamped after.
+func (s *State) MedianTimePast() uint64 {
+	if len(s.recentTimes) == 0 {
+		return s.genesisTime
+	}
+
+	times := slices.Clone(s.recentTimes)
+	slices.Sort(times)
+
+	return times[len(times)/2]
+}
+
+// MaxAllowedTime returns the latest timestamp the local clock allows.
+func MaxAllowedTime() uint64 {
+	return uint64(time.Now().Add(MaxFutureDrift).UnixNano())
+}
+
+// validateTimes checks the block timestamp against the median time past,
+// the local clock and its transactions.
+// Without a genesis time the first block may carry any past timestamp.
+func (s *State) validateTimes(b Block) error {
+	if mtp := s.MedianTimePast(); (len(s.recentTimes) > 0 || s.genesisTime > 0) && b.Header.Time <= mtp {
+		return NewBlockTooOld(b.Header.Time, mtp)
+	}
+
+	if maxTime := MaxAllowedTime(); b.Header.Time > maxTime {
+		return NewBlockInFuture(b.Header.Time, maxTime)
+	}
+
+	for _, trx := range b.TRXs {
+		if trx.Time > b.Header.Time {
+			return NewTrxInFuture(trx.Time, b.Header.Time)
+		}
+	}
+
+	return nil
+}
+
+// trackTime records the timestamp of an applied block.
+func (s *State) trackTime(blockTime uint64) {
+	s.recentTimes = append(s.recentTimes, blockTime)
+	if len(s.recentTimes) > medianTimeSpan {
+		s.recentTimes = s.recentTimes[len(s.recentTimes)-medianTimeSpan:]
+	}
+}
@@ -0,0 +1,60 @@
+package database
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestAddBlock_ValidatesTimes(t *testing.T) {
+	dataDir := setupTestDataDirWithGenesis(t, testGenesisJSON)
+
+	s, err := NewStateFromDisk(dataDir)
+	if err != nil {
+		t.Fatalf("error creating state: %v", err)
+	}
+	defer s.Close()
+
+	andrej := common.HexToAddress("0x3eb92807f1f91a8d4d85bc908c7f86dcddb1df57")
+	balances := map[common.Address]uint64{andrej: BlockReward}
+	now := uint64(time.Now().UnixNano())
+
+	inFuture := mineTestBlockAt(t, Hash{}, 0, 16, now+uint64(2*MaxFutureDrift), andrej, balances)
+	var blockInFuture ErrBlockInFuture
+	if _, err := s.AddBlock(inFuture); !errors.As(err, &blockInFuture) {
+		t.Errorf("expected block too far in the future to be rejected, got: %v", err)
+	}
+
+	parent := addTestBlock(t, s, mineTestBlockAt(t, Hash{}, 0, 16, now, andrej, balances))
+
+	balances = map[common.Address]uint64{andrej: 2 * BlockReward}
+	tooOld := mineTestBlockAt(t, parent, 1, 16, now, andrej, balances)
+	var blockTooOld ErrBlockTooOld
+	if _, err := s.AddBlock(tooOld); !errors.As(err, &blockTooOld) {
+		t.Errorf("expected block not after the median time past to be rejected, got: %v", err)
+	}
+
+	privKey, from := generateTestKey(t)
+	trx := signTestTrx(t, privKey, NewTrx(from, andrej, 1, 0, 1, ""))
+	withFutureTrx := NewBlock(parent, 1, 16, 0, trx.Time-1, andrej, Hash{}, []SignedTrx{trx})
+	var trxInFuture ErrTrxInFuture
+	if _, err := s.AddBlock(withFutureTrx); !errors.As(err, &trxInFuture) {
+		t.Errorf("expected block older than its transaction to be rejected, got: %v", err)
+	}
+
+	addTestBlock(t, s, mineTestBlockAt(t, parent, 1, 16, now+1, andrej, balances))
+}
+
+func TestMedianTimePast(t *testing.T) {
+	s := &State{}
+	for _, blockTime := range []uint64{5, 1, 9, 3, 7, 100, 2, 8, 4, 6, 10, 11} {
+		s.trackTime(blockTime)
+	}
+
+	// The first time falls out of the 11 tracked ones: 1-4, 6-11 and 100.
+	if got := s.MedianTimePast(); got != 7 {
+		t.Errorf("median time past should be 7 not %d", got)
+	}
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
 )
 
 type (
@@ -17,6 +18,8 @@ type (
 		From  common.Address `json:"from"`
 		To    common.Address `json:"to"`
 		Value uint64         `json:"value"`
+		Fee   uint64         `json:"fee"`
+		Nonce uint64         `json:"nonce"`
 		Data  string         `json:"data"`
 		Time  uint64         `json:"time"`
 	}
@@ -34,8 +37,13 @@ func NewSignedTrx(trx Trx, sig []byte) SignedTrx {
 	return SignedTrx{trx, sig}
 }
 
-func NewTrx(from common.Address, to common.Address, value uint64, data string) Trx {
-	return Trx{from, to, value, data, uint64(time.Now().UnixNano())}
+func NewTrx(from common.Address, to common.Address, value uint64, fee uint64, nonce uint64, data string) Trx {
+	return Trx{from, to, value, fee, nonce, data, uint64(time.Now().UnixNano())}
+}
+
+// Cost is the value plus the fee debited from the sender.
+func (t Trx) Cost() uint64 {
+	return t.Value + t.Fee
 }
 
 func (t Trx) IsReward() bool {
@@ -43,28 +51,47 @@ func (t Trx) IsReward() bool {
 }
 
 func (t Trx) Hash() (Hash, error) {
-	trxJSON, err := t.Encode()
+	trxRLP, err := t.Encode()
 	if err != nil {
 		return Hash{}, err
 	}
 
-	return sha256.Sum256(trxJSON), nil
+	return sha256.Sum256(trxRLP), nil
 }
 
+// Encode returns the canonical binary encoding of the unsigned transaction.
 func (t Trx) Encode() ([]byte, error) {
-	return json.Marshal(t)
+	return rlp.EncodeToBytes(t)
+}
+
+// SigningPayload binds the signature to one network through the chain ID.
+func (t Trx) SigningPayload(chainID string) ([]byte, error) {
+	return json.Marshal(struct {
+		ChainID string `json:"chain_id"`
+		Trx
+	}{chainID, t})
+}
+
+func (t Trx) SigningHash(chainID string) (Hash, error) {
+	payload, err := t.SigningPayload(chainID)
+	if err != nil {
+		return Hash{}, err
+	}
+
+	return sha256.Sum256(payload), nil
 }
 
 func (st SignedTrx) Hash() (Hash, error) {
-	trxJSON, err := st.Encode()
+	trxRLP, err := st.Encode()
 	if err != nil {
 		return Hash{}, nil
 	}
-	return sha256.Sum256(trxJSON), nil
+	return sha256.Sum256(trxRLP), nil
 }
 
-func (st SignedTrx) IsAuthentic() (bool, error) {
-	trxHash, err := st.Trx.Hash()
+// IsAuthentic reports whether the sender signed the transaction for chainID.
+func (st SignedTrx) IsAuthentic(chainID string) (bool, error) {
+	trxHash, err := st.Trx.SigningHash(chainID)
 	if err != nil {
 		return false, err
 	}
@@ -0,0 +1,97 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+const indexMarkKey = "index-mark"
+
+type (
+	// TrxLocation is where a mined transaction is stored in the main chain.
+	TrxLocation struct {
+		BlockHeight uint64 `json:"block_height"`
+		BlockHash   Hash   `json:"block_hash"`
+		Position    uint64 `json:"position"`
+	}
+
+	// indexMark records the main chain blocks the indexes cover.
+	indexMark struct {
+		Length uint64 `json:"length"`
+		Hash   Hash   `json:"block_hash"`
+	}
+)
+
+// indexTRXs stores the location of every transaction of a main chain block.
+func (s *State) indexTRXs(blockFS BlockFS) error {
+	for i, trx := range blockFS.Value.TRXs {
+		trxHash, err := trx.Hash()
+		if err != nil {
+			return err
+		}
+
+		locationJSON, err := json.Marshal(TrxLocation{blockFS.Value.Header.Height, blockFS.Key, uint64(i)})
+		if err != nil {
+			return err
+		}
+		if err := s.store.PutState(trxKey(trxHash), locationJSON); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *State) unindexTRXs(blockFS BlockFS) error {
+	for _, trx := range blockFS.Value.TRXs {
+		trxHash, err := trx.Hash()
+		if err != nil {
+			return err
+		}
+		if err := s.store.DeleteState(trxKey(trxHash)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetTrx looks up a mined transaction by its hash.
+func (s *State) GetTrx(trxHash Hash) (SignedTrx, TrxLocation, error) {
+	locationJSON, err := s.store.GetState(trxKey(trxHash))
+	var notFound ErrStateNotFound
+	if errors.As(err, &notFound) {
+		return SignedTrx{}, TrxLocation{}, NewTrxNotFound(trxHash)
+	}
+	if err != nil {
+		return SignedTrx{}, TrxLocation{}, err
+	}
+
+	var location TrxLocation
+	if err := json.Unmarshal(locationJSON, &location); err != nil {
+		return SignedTrx{}, TrxLocation{}, err
+	}
+
+	blockFS, err := s.store.BlockByHeight(location.BlockHeight)
+	if err != nil {
+		return SignedTrx{}, TrxLocation{}, err
+	}
+
+	// Left over by an interrupted rollback.
+	if blockFS.Key != location.BlockHash || location.Position >= uint64(len(blockFS.Value.TRXs)) {
+		return SignedTrx{}, TrxLocation{}, NewTrxNotFound(trxHash)
+	}
+
+	return blockFS.Value.TRXs[location.Position], location, nil
+}
+
+// Confirmations counts the blocks from height to the latest, inclusive.
+func (s *State) Confirmations(height uint64) uint64 {
+	if height >= s.NextBlockHeight() {
+		return 0
+	}
+	return s.NextBlockHeight() - height
+}
+
+func trxKey(hash Hash) string {
+	return fmt.Sprintf("trx-%x", hash)
+}
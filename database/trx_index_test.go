@@ -0,0 +1,107 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestGetTrx(t *testing.T) {
+	privKey, from := generateTestKey(t)
+	to := common.HexToAddress("0x6fdc0d8d15ae6b4ebf45c52fd2aafbcbb19a65c8")
+	andrej := common.HexToAddress("0x3eb92807f1f91a8d4d85bc908c7f86dcddb1df57")
+	babayaga := common.HexToAddress("0x22ba1F80452E6220c7cc6ea2D1e3EEDDaC5F694A")
+
+	dataDir := setupTestDataDirWithGenesis(t, fmt.Sprintf(
+		`{"difficulty": 16, "retarget_interval": 0, "balances": {"%s": 1000}}`, from.Hex()))
+
+	s, err := NewStateFromDisk(dataDir)
+	if err != nil {
+		t.Fatalf("error creating state: %v", err)
+	}
+
+	a0 := mineTestBlock(t, Hash{}, 0, 16, andrej, map[common.Address]uint64{from: 1000, andrej: BlockReward})
+	a0Hash := addTestBlock(t, s, a0)
+
+	trx := signTestTrx(t, privKey, NewTrx(from, to, 10, 1, 1, ""))
+	trxHash, err := trx.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stateRoot, err := s.PendingStateRoot(andrej, []SignedTrx{trx})
+	if err != nil {
+		t.Fatalf("error computing state root: %v", err)
+	}
+	var a1 Block
+	for nonce := uint32(0); ; nonce++ {
+		a1 = NewBlock(a0Hash, 1, 16, nonce, uint64(time.Now().UnixNano()), andrej, stateRoot, []SignedTrx{trx})
+		if hash, _ := a1.Hash(); hash.MeetsDifficulty(16) {
+			break
+		}
+	}
+	a1Hash := addTestBlock(t, s, a1)
+
+	assertIndexed := func(s *State) {
+		t.Helper()
+
+		got, location, err := s.GetTrx(trxHash)
+		if err != nil {
+			t.Fatalf("error looking up transaction: %v", err)
+		}
+		if location.BlockHash != a1Hash || location.BlockHeight != 1 || location.Position != 0 {
+			t.Errorf("unexpected transaction location: %+v", location)
+		}
+		if got.Value != trx.Value || got.To != trx.To {
+			t.Errorf("unexpected transaction: %+v", got)
+		}
+		if s.Confirmations(location.BlockHeight) != 1 {
+			t.Errorf("transaction should have 1 confirmation not %d", s.Confirmations(location.BlockHeight))
+		}
+	}
+
+	assertIndexed(s)
+
+	if err := s.Close(); err != nil {
+		t.Fatalf("error closing state: %v", err)
+	}
+	s, err = NewStateFromDisk(dataDir)
+	if err != nil {
+		t.Fatalf("error reloading state: %v", err)
+	}
+	defer func() { s.Close() }()
+
+	assertIndexed(s)
+
+	// A rollback interrupted after dropping the block from the indexes
+	// leaves it to be indexed again on boot.
+	var notFound ErrTrxNotFound
+	if err := s.unindexBlocks(1); err != nil {
+		t.Fatalf("error dropping block from the indexes: %v", err)
+	}
+	if _, _, err := s.GetTrx(trxHash); !errors.As(err, &notFound) {
+		t.Errorf("transaction of an unindexed block should not be found, got: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("error closing state: %v", err)
+	}
+	s, err = NewStateFromDisk(dataDir)
+	if err != nil {
+		t.Fatalf("error reloading state: %v", err)
+	}
+
+	assertIndexed(s)
+
+	// A heavier side chain without the transaction replaces its block.
+	b1 := mineTestBlock(t, a0Hash, 1, 16, babayaga, map[common.Address]uint64{from: 1000, andrej: BlockReward, babayaga: BlockReward})
+	b1Hash := addTestBlock(t, s, b1)
+	b2 := mineTestBlock(t, b1Hash, 2, 16, babayaga, map[common.Address]uint64{from: 1000, andrej: BlockReward, babayaga: 2 * BlockReward})
+	addTestBlock(t, s, b2)
+
+	if _, _, err := s.GetTrx(trxHash); !errors.As(err, &notFound) {
+		t.Errorf("transaction of a replaced block should no longer be found, got: %v", err)
+	}
+}
@@ -0,0 +1,159 @@
+package database
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/marc-watters/the-block-chain-bar/v2/fs"
+)
+
+type (
+	// VerifyReport describes the outcome of verifying the stored chain.
+	VerifyReport struct {
+		Valid        bool           `json:"valid"`
+		FirstHeight  uint64         `json:"first_height"`
+		Verified     uint64         `json:"verified_blocks"`
+		LatestHash   Hash           `json:"latest_block_hash"`
+		FromSnapshot bool           `json:"from_snapshot"`
+		Failure      *VerifyFailure `json:"failure,omitempty"`
+	}
+
+	// VerifyFailure is why the block at Height failed verification.
+	VerifyFailure struct {
+		Height uint64 `json:"height"`
+		Hash   Hash   `json:"hash"`
+		Reason string `json:"reason"`
+	}
+)
+
+// VerifyChain validates the stored blocks and snapshots of a data directory
+// opened read-only.
+func VerifyChain(dataDir string, opts ...Option) (VerifyReport, error) {
+	dataDir = fs.ExpandPath(dataDir)
+
+	if !fs.FileExist(fs.GetGenesisJSONFilePath(dataDir)) {
+		return VerifyReport{}, fmt.Errorf("'%s' holds no database", dataDir)
+	}
+
+	o := options{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	o.readOnly = true
+
+	s, err := openState(dataDir, o)
+	if err != nil {
+		return VerifyReport{}, err
+	}
+	defer s.Close()
+
+	return s.verify()
+}
+
+func (s *State) verify() (VerifyReport, error) {
+	report := VerifyReport{Valid: true}
+	v := s.genesisState()
+
+	heights, err := s.snapshotHeights()
+	if err != nil {
+		return report, err
+	}
+
+	if base := s.store.Base(); base > 0 {
+		snapshot, ok := s.oldestRestorableSnapshot(heights, base)
+		if !ok {
+			return report, fmt.Errorf("no snapshot restores the chain pruned below height %d", base)
+		}
+		if err := v.restoreSnapshot(snapshot); err != nil {
+			return report, err
+		}
+		report.FirstHeight = snapshot.Height + 1
+		report.FromSnapshot = true
+		report.LatestHash = snapshot.Hash
+	}
+
+	fail := func(height uint64, hash Hash, reason string) (VerifyReport, error) {
+		report.Valid = false
+		report.Failure = &VerifyFailure{height, hash, reason}
+		return report, nil
+	}
+
+	for height := report.FirstHeight; height < s.store.Len(); height++ {
+		blockFS, err := s.store.BlockByHeight(height)
+		if err != nil {
+			return fail(height, Hash{}, fmt.Sprintf("unreadable block: %v", err))
+		}
+
+		hash, err := blockFS.Value.Hash()
+		if err != nil {
+			return fail(height, blockFS.Key, fmt.Sprintf("unable to hash block: %v", err))
+		}
+		if hash != blockFS.Key {
+			return fail(height, blockFS.Key, fmt.Sprintf("stored hash doesn't match the block hash '%s'", hash.Hex()))
+		}
+
+		if err := applyBlock(blockFS.Value, &v); err != nil {
+			return fail(height, blockFS.Key, err.Error())
+		}
+
+		if slices.Contains(heights, height) {
+			if reason := v.checkSnapshot(height); reason != "" {
+				return fail(height, blockFS.Key, reason)
+			}
+		}
+
+		report.Verified++
+		report.LatestHash = hash
+	}
+
+	if damage, ok := s.store.Damaged(); ok {
+		return fail(damage.Height, Hash{}, fmt.Sprintf("unreadable block record: %s", damage.Reason))
+	}
+
+	return report, nil
+}
+
+// oldestRestorableSnapshot returns the oldest snapshot that can be restored.
+func (s *State) oldestRestorableSnapshot(heights []uint64, base uint64) (Snapshot, bool) {
+	for _, height := range heights {
+		if height >= s.store.Len() || s.snapshotBase(height) < base {
+			continue
+		}
+
+		snapshot, err := s.loadSnapshot(height)
+		if err != nil {
+			continue
+		}
+		blockFS, err := s.store.BlockByHeight(height)
+		if err != nil || blockFS.Key != snapshot.Hash {
+			continue
+		}
+
+		return snapshot, true
+	}
+
+	return Snapshot{}, false
+}
+
+// checkSnapshot compares the snapshot at height with the replayed state.
+func (s *State) checkSnapshot(height uint64) string {
+	snapshot, err := s.loadSnapshot(height)
+	if err != nil {
+		return fmt.Sprintf("unreadable snapshot: %v", err)
+	}
+	if snapshot.Hash != s.latestBlockHash {
+		return ""
+	}
+
+	switch {
+	case !maps.Equal(snapshot.Balances, s.balances):
+		return "snapshot balances don't match the replayed balances"
+	case !maps.Equal(snapshot.Nonces, s.accountNonces):
+		return "snapshot nonces don't match the replayed nonces"
+	case snapshot.ChainWork != s.chainWork:
+		return fmt.Sprintf("snapshot chain work '%d' doesn't match the replayed chain work '%d'", snapshot.ChainWork, s.chainWork)
+	}
+
+	return ""
+}
@@ -0,0 +1,210 @@
+package database
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/marc-watters/the-block-chain-bar/v2/fs"
+)
+
+func TestVerifyChain(t *testing.T) {
+	andrej := common.HexToAddress("0x3eb92807f1f91a8d4d85bc908c7f86dcddb1df57")
+
+	// setupChain stores blocks 0 and 1 and returns block 2 unstored.
+	setupChain := func(t *testing.T) (string, Block) {
+		t.Helper()
+
+		dataDir := setupTestDataDirWithGenesis(t, testGenesisJSON)
+		s, err := NewStateFromDisk(dataDir)
+		if err != nil {
+			t.Fatalf("error creating state: %v", err)
+		}
+		defer s.Close()
+
+		var parent Hash
+		for height := uint64(0); height < 2; height++ {
+			b := mineTestBlock(t, parent, height, 16, andrej, map[common.Address]uint64{andrej: (height + 1) * BlockReward})
+			parent = addTestBlock(t, s, b)
+		}
+
+		return dataDir, mineTestBlock(t, parent, 2, 16, andrej, map[common.Address]uint64{andrej: 3 * BlockReward})
+	}
+
+	appendBlock := func(t *testing.T, dataDir string, blockFS BlockFS) {
+		t.Helper()
+
+		store, err := openStorage(dataDir, options{})
+		if err != nil {
+			t.Fatalf("error opening storage: %v", err)
+		}
+		defer store.Close()
+
+		if err := store.AppendBlock(blockFS); err != nil {
+			t.Fatalf("error appending block: %v", err)
+		}
+	}
+
+	// appendRecord writes raw bytes to the end of block.db, bypassing the
+	// checks of the storage.
+	appendRecord := func(t *testing.T, dataDir string, record []byte) {
+		t.Helper()
+
+		f, err := fs.AppFS.OpenFile(fs.GetBlocksDBFilePath(dataDir), os.O_APPEND|os.O_WRONLY, 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		if _, err := f.Write(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		dataDir, next := setupChain(t)
+		hash, err := next.Hash()
+		if err != nil {
+			t.Fatal(err)
+		}
+		appendBlock(t, dataDir, BlockFS{hash, next})
+
+		report, err := VerifyChain(dataDir)
+		if err != nil {
+			t.Fatalf("error verifying chain: %v", err)
+		}
+		if !report.Valid || report.Verified != 3 || report.LatestHash != hash {
+			t.Errorf("expected 3 valid blocks up to %s, got %+v", hash.Hex(), report)
+		}
+	})
+
+	t.Run("stored hash", func(t *testing.T) {
+		dataDir, next := setupChain(t)
+		appendBlock(t, dataDir, BlockFS{Hash{9}, next})
+
+		report, err := VerifyChain(dataDir)
+		if err != nil {
+			t.Fatalf("error verifying chain: %v", err)
+		}
+		if report.Valid || report.Failure == nil || report.Failure.Height != 2 || !strings.Contains(report.Failure.Reason, "stored hash") {
+			t.Errorf("expected block 2 to fail on its stored hash, got %+v", report.Failure)
+		}
+		if report.Verified != 2 {
+			t.Errorf("2 blocks should verify not %d", report.Verified)
+		}
+	})
+
+	t.Run("balances", func(t *testing.T) {
+		dataDir, _ := setupChain(t)
+		s, err := NewStateFromDisk(dataDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		next := mineTestBlock(t, s.LatestBlockHash(), 2, 16, andrej, map[common.Address]uint64{andrej: 30 * BlockReward})
+		s.Close()
+
+		hash, err := next.Hash()
+		if err != nil {
+			t.Fatal(err)
+		}
+		appendBlock(t, dataDir, BlockFS{hash, next})
+
+		report, err := VerifyChain(dataDir)
+		if err != nil {
+			t.Fatalf("error verifying chain: %v", err)
+		}
+		if report.Valid || report.Failure == nil || report.Failure.Height != 2 || !strings.Contains(report.Failure.Reason, "state root") {
+			t.Errorf("expected block 2 to fail on its state root, got %+v", report.Failure)
+		}
+	})
+
+	t.Run("pruned", func(t *testing.T) {
+		dataDir := setupTestDataDirWithGenesis(t, testGenesisJSON)
+		s, err := NewStateFromDisk(dataDir, WithSegmentSize(1), WithSnapshotInterval(10), WithPruning(MinPruneKeep))
+		if err != nil {
+			t.Fatalf("error creating state: %v", err)
+		}
+
+		var parent Hash
+		for height := uint64(0); height <= MinPruneKeep+30; height++ {
+			b := mineTestBlock(t, parent, height, 16, andrej, map[common.Address]uint64{andrej: (height + 1) * BlockReward})
+			parent = addTestBlock(t, s, b)
+		}
+		s.Close()
+
+		report, err := VerifyChain(dataDir)
+		if err != nil {
+			t.Fatalf("error verifying chain: %v", err)
+		}
+		if !report.Valid || !report.FromSnapshot || report.LatestHash != parent {
+			t.Errorf("expected the pruned chain to verify from a snapshot, got %+v", report)
+		}
+		if report.FirstHeight+report.Verified != MinPruneKeep+31 {
+			t.Errorf("blocks from height %d on should verify, %d did", report.FirstHeight, report.Verified)
+		}
+	})
+	t.Run("non-contiguous record", func(t *testing.T) {
+		dataDir, next := setupChain(t)
+		next.Header.Height = 5
+		hash, err := next.Hash()
+		if err != nil {
+			t.Fatal(err)
+		}
+		record, err := BlockFS{hash, next}.Encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		appendRecord(t, dataDir, record)
+
+		report, err := VerifyChain(dataDir)
+		if err != nil {
+			t.Fatalf("error verifying chain: %v", err)
+		}
+		if report.Valid || report.Failure == nil || report.Failure.Height != 2 || !strings.Contains(report.Failure.Reason, "unreadable block record") {
+			t.Errorf("expected the record following block 1 to fail, got %+v", report.Failure)
+		}
+		if report.Verified != 2 {
+			t.Errorf("2 blocks should verify not %d", report.Verified)
+		}
+	})
+
+	t.Run("read-only", func(t *testing.T) {
+		dataDir, next := setupChain(t)
+		hash, err := next.Hash()
+		if err != nil {
+			t.Fatal(err)
+		}
+		record, err := BlockFS{hash, next}.Encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		appendRecord(t, dataDir, record[:len(record)/2])
+
+		before, err := fs.AppFS.ReadFile(fs.GetBlocksDBFilePath(dataDir))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		report, err := VerifyChain(dataDir, WithSegmentSize(1))
+		if err != nil {
+			t.Fatalf("error verifying chain: %v", err)
+		}
+		if !report.Valid || report.Verified != 2 {
+			t.Errorf("expected the 2 complete blocks to verify, got %+v", report)
+		}
+
+		after, err := fs.AppFS.ReadFile(fs.GetBlocksDBFilePath(dataDir))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(before, after) {
+			t.Errorf("verifying should leave block.db untouched, including its torn record")
+		}
+		if exists, _ := fs.DirExists(fs.GetSegmentsDirPath(dataDir)); exists {
+			t.Errorf("verifying should not seal segments")
+		}
+	})
+}
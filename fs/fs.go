@@ -11,9 +11,12 @@ import (
 )
 
 const (
-	Dir     = "database"
-	GenFile = "genesis.json"
-	TrxFile = "block.db"
+	Dir        = "database"
+	GenFile    = "genesis.json"
+	TrxFile    = "block.db"
+	StateDir   = "state"
+	BlocksDir  = "blocks"
+	LevelDBDir = "chain.ldb"
 )
 
 var AppFS *afero.Afero
@@ -26,6 +29,9 @@ var GenesisJSON = `
 {
   "genesis_time": "2019-03-18T00:00:00.000000000Z",
   "chain_id": "the-blockchain-bar-ledger",
+  "difficulty": 16777216,
+  "block_time": 30,
+  "retarget_interval": 20,
   "balances": {
     "0x22ba1F80452E6220c7cc6ea2D1e3EEDDaC5F694A": 1000000
   }
@@ -63,6 +69,18 @@ func GetBlocksDBFilePath(dataDir string) string {
 	return filepath.Join(GetDatabaseDirPath(dataDir), TrxFile)
 }
 
+func GetStateDirPath(dataDir string) string {
+	return filepath.Join(GetDatabaseDirPath(dataDir), StateDir)
+}
+
+func GetSegmentsDirPath(dataDir string) string {
+	return filepath.Join(GetDatabaseDirPath(dataDir), BlocksDir)
+}
+
+func GetLevelDBDirPath(dataDir string) string {
+	return filepath.Join(GetDatabaseDirPath(dataDir), LevelDBDir)
+}
+
 func FileExist(path string) bool {
 	_, err := AppFS.Stat(path)
 	if err != nil && os.IsNotExist(err) {
@@ -2,12 +2,17 @@ package node
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rlp"
 
 	db "github.com/marc-watters/the-block-chain-bar/v2/database"
 )
@@ -25,24 +30,110 @@ type (
 		FromPwd string `json:"from_pwd"`
 		To      string `json:"to"`
 		Value   uint64 `json:"value"`
+		Fee     uint64 `json:"fee"`
 		Data    string `json:"data"`
 	}
 	TrxPostRes struct {
 		Success bool `json:"success"`
 	}
+	// TrxSubmitRes lists the accepted and rejected submitted transactions.
+	TrxSubmitRes struct {
+		Accepted []db.Hash      `json:"accepted"`
+		Rejected []TrxRejection `json:"rejected"`
+	}
+	TrxRejection struct {
+		Hash  db.Hash `json:"hash"`
+		Error string  `json:"error"`
+	}
 	StatusRes struct {
+		ChainID     string              `json:"chain_id"`
 		Hash        db.Hash             `json:"block_hash"`
 		Height      uint64              `json:"block_height"`
+		ChainWork   uint64              `json:"chain_work"`
+		FirstHeight uint64              `json:"first_block_height"`
 		KnownPeers  map[string]PeerNode `json:"peers_known"`
 		PendingTRXs []db.SignedTrx      `json:"pending_trxs"`
 	}
+	HistoryRes struct {
+		Account common.Address    `json:"account"`
+		Total   uint64            `json:"total"`
+		Offset  uint64            `json:"offset"`
+		Entries []db.HistoryEntry `json:"entries"`
+	}
+	NonceRes struct {
+		Account common.Address `json:"account"`
+		Nonce   uint64         `json:"nonce"`
+	}
+	BalanceProofRes struct {
+		Hash      db.Hash       `json:"block_hash"`
+		StateRoot db.Hash       `json:"state_root"`
+		Proof     db.StateProof `json:"proof"`
+	}
+	TrxRes struct {
+		Hash          db.Hash        `json:"hash"`
+		Trx           db.SignedTrx   `json:"trx"`
+		Location      db.TrxLocation `json:"location"`
+		Confirmations uint64         `json:"confirmations"`
+	}
+	// BlockRes is a block with its hash, transaction hashes and miner earnings.
+	BlockRes struct {
+		Hash          db.Hash   `json:"hash"`
+		Block         db.Block  `json:"block"`
+		TrxHashes     []db.Hash `json:"trx_hashes"`
+		Reward        uint64    `json:"reward"`
+		Confirmations uint64    `json:"confirmations"`
+	}
+	BlocksRes struct {
+		Blocks []BlockRes `json:"blocks"`
+	}
+	TrxProofRes struct {
+		BlockHash db.Hash        `json:"block_hash"`
+		Header    db.BlockHeader `json:"header"`
+		Proof     db.MerkleProof `json:"proof"`
+	}
+	// SyncRes holds no blocks when the requested block was pruned.
 	SyncRes struct {
-		Blocks []db.Block `json:"blocks"`
+		Blocks      []db.Block `json:"blocks"`
+		FirstHeight uint64     `json:"first_height"`
+		LastHeight  uint64     `json:"last_height"`
 	}
 	AddPeerRes struct {
 		Success bool   `json:"success"`
 		Error   string `json:"error"`
 	}
+
+	// errPeerStatus is returned for a peer response with a non-200 status.
+	errPeerStatus struct {
+		status int
+		msg    string
+	}
+)
+
+func NewBlockRes(hash db.Hash, block db.Block, confirmations uint64) (BlockRes, error) {
+	trxHashes := make([]db.Hash, 0, len(block.TRXs))
+	for _, trx := range block.TRXs {
+		trxHash, err := trx.Hash()
+		if err != nil {
+			return BlockRes{}, err
+		}
+		trxHashes = append(trxHashes, trxHash)
+	}
+
+	return BlockRes{hash, block, trxHashes, block.Reward(), confirmations}, nil
+}
+
+func newErrPeerStatus(status int, msg string) errPeerStatus {
+	return errPeerStatus{status, msg}
+}
+
+func (e errPeerStatus) Error() string {
+	return fmt.Sprintf("peer responded with status %d: %s", e.status, e.msg)
+}
+
+const (
+	contentTypeJSON = "application/json"
+	// contentTypeRLP is the media type of bodies encoded by db.BlockFS.Encode.
+	contentTypeRLP = "application/x-rlp"
 )
 
 func writeRes(w http.ResponseWriter, data any) {
@@ -52,29 +143,96 @@ func writeRes(w http.ResponseWriter, data any) {
 		return
 	}
 
+	w.Header().Set("Content-Type", contentTypeJSON)
 	if _, err := w.Write(dataJSON); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		return
 	}
 }
 
+// writeNegotiatedRes writes data in RLP when the client accepts it.
+func writeNegotiatedRes(w http.ResponseWriter, r *http.Request, data any) {
+	if !acceptsRLP(r) {
+		writeRes(w, data)
+		return
+	}
+
+	dataRLP, err := rlp.EncodeToBytes(data)
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentTypeRLP)
+	if _, err := w.Write(dataRLP); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+}
+
 func writeErr(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+
+	var notFound db.ErrBlockNotFound
+	var trxNotFound db.ErrTrxNotFound
+	var pruned db.ErrBlockPruned
+	if errors.As(err, &notFound) || errors.As(err, &trxNotFound) {
+		status = http.StatusNotFound
+	}
+	if errors.As(err, &pruned) {
+		status = http.StatusGone
+	}
+
 	errJSON, err := json.Marshal(ErrRes{err.Error()})
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		return
 	}
 
-	http.Error(w, string(errJSON), http.StatusInternalServerError)
+	http.Error(w, string(errJSON), status)
+}
+
+func acceptsRLP(r *http.Request) bool {
+	for _, accept := range r.Header.Values("Accept") {
+		for _, mediaRange := range strings.Split(accept, ",") {
+			mediaType, _, err := mime.ParseMediaType(mediaRange)
+			if err == nil && mediaType == contentTypeRLP {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseUintQuery parses an unsigned integer query parameter, def if missing.
+func parseUintQuery(r *http.Request, key string, def uint64) (uint64, error) {
+	raw := r.URL.Query().Get(key)
+	if raw == "" {
+		return def, nil
+	}
+
+	value, err := strconv.ParseUint(raw, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid '%s' query parameter '%s': %v", key, raw, err)
+	}
+
+	return value, nil
 }
 
+// maxReqBodySize bounds the request bodies to a full block.
+const maxReqBodySize = db.MaxBlockSize
+
 func readReq(r *http.Request, reqBody any) error {
-	reqBodyJSON, err := io.ReadAll(r.Body)
+	reqBodyJSON, err := io.ReadAll(io.LimitReader(r.Body, maxReqBodySize+1))
 	if err != nil {
 		return fmt.Errorf("unable to read request body: %v", err)
 	}
 	defer r.Body.Close()
 
+	if len(reqBodyJSON) > maxReqBodySize {
+		return fmt.Errorf("request body exceeds the maximum of %d bytes", maxReqBodySize)
+	}
+
 	if err := json.Unmarshal(reqBodyJSON, &reqBody); err != nil {
 		return fmt.Errorf("unable to unmarshal request body: %v", err)
 	}
@@ -82,12 +240,35 @@ func readReq(r *http.Request, reqBody any) error {
 	return nil
 }
 
+// maxResBodySize bounds the peer responses to a page of synced blocks, JSON
+// taking at most 6 bytes per byte of a block's binary encoding.
+const maxResBodySize = maxSyncBlocks * 6 * db.MaxBlockSize
+
 func readRes(r *http.Response, reqBody any) error {
-	reqBodyJSON, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+
+	reqBodyJSON, err := io.ReadAll(io.LimitReader(r.Body, maxResBodySize+1))
 	if err != nil {
 		return fmt.Errorf("unable to read response body. %s", err.Error())
 	}
-	defer r.Body.Close()
+	if len(reqBodyJSON) > maxResBodySize {
+		return fmt.Errorf("response body exceeds the maximum of %d bytes", maxResBodySize)
+	}
+
+	if r.StatusCode != http.StatusOK {
+		var errRes ErrRes
+		if err := json.Unmarshal(reqBodyJSON, &errRes); err != nil || errRes.Error == "" {
+			return newErrPeerStatus(r.StatusCode, string(reqBodyJSON))
+		}
+		return newErrPeerStatus(r.StatusCode, errRes.Error)
+	}
+
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == contentTypeRLP {
+		if err := rlp.DecodeBytes(reqBodyJSON, reqBody); err != nil {
+			return fmt.Errorf("unable to decode response body. %s", err.Error())
+		}
+		return nil
+	}
 
 	err = json.Unmarshal(reqBodyJSON, &reqBody)
 	if err != nil {
@@ -0,0 +1,28 @@
+package node
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestReadRes_RejectsOversizedBody(t *testing.T) {
+	newRes := func(body io.Reader) *http.Response {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": {contentTypeJSON}},
+			Body:       io.NopCloser(body),
+		}
+	}
+
+	var status StatusRes
+	if err := readRes(newRes(strings.NewReader(`{"block_height": 3}`)), &status); err != nil || status.Height != 3 {
+		t.Fatalf("expected a small response to be read, got height %d: %v", status.Height, err)
+	}
+
+	oversized := io.MultiReader(strings.NewReader(`{"chain_id": "`), strings.NewReader(strings.Repeat("a", maxResBodySize)), strings.NewReader(`"}`))
+	if err := readRes(newRes(oversized), &status); err == nil {
+		t.Errorf("expected a response over %d bytes to be rejected", maxResBodySize)
+	}
+}
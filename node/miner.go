@@ -4,7 +4,6 @@ import (
 	"context"
 	"fmt"
 	"math/rand"
-	"sort"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -13,16 +12,20 @@ import (
 )
 
 type PendingBlock struct {
-	parent db.Hash
-	height uint64
-	time   uint64
-	miner  common.Address
-	trxs   []db.SignedTrx
+	parent     db.Hash
+	height     uint64
+	difficulty uint64
+	time       uint64
+	miner      common.Address
+	stateRoot  db.Hash
+	trxs       []db.SignedTrx
 }
 
-func NewPendingBlock(parent db.Hash, height uint64, miner common.Address, trxs []db.SignedTrx) PendingBlock {
+// NewPendingBlock prepares a block for mining with the state root of its
+// transactions.
+func NewPendingBlock(parent db.Hash, height uint64, difficulty uint64, miner common.Address, stateRoot db.Hash, trxs []db.SignedTrx) PendingBlock {
 	t := uint64(time.Now().UnixNano())
-	return PendingBlock{parent, height, t, miner, trxs}
+	return PendingBlock{parent, height, difficulty, t, miner, stateRoot, trxs}
 }
 
 func Mine(ctx context.Context, pb PendingBlock) (db.Block, error) {
@@ -30,19 +33,16 @@ func Mine(ctx context.Context, pb PendingBlock) (db.Block, error) {
 		return db.Block{}, fmt.Errorf("mining empty blocks is not allowed")
 	}
 
-	sort.Slice(pb.trxs, func(i, j int) bool {
-		return pb.trxs[i].Time < pb.trxs[j].Time
-	})
-
 	start := time.Now()
 	attempt := 0
 	var (
-		block db.Block
 		hash  db.Hash
 		nonce uint32
 	)
 
-	for !hash.IsValid() {
+	block := db.NewBlock(pb.parent, pb.height, pb.difficulty, 0, pb.time, pb.miner, pb.stateRoot, pb.trxs)
+
+	for {
 		select {
 		case <-ctx.Done():
 			fmt.Println("Mining cancelled")
@@ -57,17 +57,21 @@ func Mine(ctx context.Context, pb PendingBlock) (db.Block, error) {
 			fmt.Println("Mining", len(pb.trxs), "pending transactions. Attempt:", attempt)
 		}
 
-		block = db.NewBlock(pb.parent, pb.height, nonce, pb.time, pb.miner, pb.trxs)
+		block.Header.Nonce = nonce
 		blockHash, err := block.Hash()
 		if err != nil {
 			return db.Block{}, fmt.Errorf("couldn't mine block: %v", err)
 		}
 
 		hash = blockHash
+		if hash.MeetsDifficulty(pb.difficulty) {
+			break
+		}
 	}
 
 	fmt.Printf("\nMined new Block '%x' using PoW🎉🎉🎉:\n", hash)
 	fmt.Printf("\tHeight: '%v'\n", block.Header.Height)
+	fmt.Printf("\tDifficulty: '%v'\n", block.Header.Difficulty)
 	fmt.Printf("\tNonce: '%v'\n", block.Header.Nonce)
 	fmt.Printf("\tCreated: '%v'\n", block.Header.Time)
 	fmt.Printf("\tMiner '%v'\n", block.Header.Miner.String())
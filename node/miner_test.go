@@ -24,7 +24,7 @@ func TestValidBlockHash(t *testing.T) {
 		t.Fatalf("error decoding hash: %v", err)
 	}
 
-	got := hash.IsValid()
+	got := hash.MeetsDifficulty(db.DefaultDifficulty)
 	want := true
 
 	if got != want {
@@ -40,7 +40,7 @@ func TestInvalidBlockHash(t *testing.T) {
 		t.Fatalf("error decoding hash: %v", err)
 	}
 
-	got := hash.IsValid()
+	got := hash.MeetsDifficulty(db.DefaultDifficulty)
 	want := false
 	if got != want {
 		t.Errorf("hash should be invalid: %s:", hexHash)
@@ -70,7 +70,7 @@ func TestMine(t *testing.T) {
 		t.Fatalf("error hashing block: %v", err)
 	}
 
-	if !minedBlockHash.IsValid() {
+	if !minedBlockHash.MeetsDifficulty(minedBlock.Header.Difficulty) {
 		t.Fatal("expected mined block hash to be valid")
 	}
 
@@ -114,15 +114,15 @@ func generateKey() (*ecdsa.PrivateKey, ecdsa.PublicKey, common.Address, error) {
 }
 
 func createRandomPendingBlock(privKey *ecdsa.PrivateKey, acc common.Address) (PendingBlock, error) {
-	trx := db.NewTrx(acc, db.NewAccount(testKsBabaYagaAccount), 1, "")
-	signedTrx, err := wallet.SignTrx(trx, privKey)
+	trx := db.NewTrx(acc, db.NewAccount(testKsBabaYagaAccount), 1, 0, 1, "")
+	signedTrx, err := wallet.SignTrx(trx, "", privKey)
 	if err != nil {
 		return PendingBlock{}, err
 	}
 
 	return NewPendingBlock(
 		db.Hash{},
-		0, acc,
+		0, db.DefaultDifficulty, acc, db.Hash{},
 		[]db.SignedTrx{signedTrx},
 	), nil
 }
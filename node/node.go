@@ -5,8 +5,10 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"net/http"
 	"os"
+	"sort"
 	"strconv"
 	"time"
 
@@ -25,22 +27,58 @@ const (
 	DefaultIP      = "127.0.0.1"
 	DefaultHTTPort = 8080
 
-	endpointBalances              = "/balances/list"
-	endpointPostTrx               = "/trx/add"
-	endpointStatus                = "/node/status"
-	endpointSync                  = "/node/sync"
-	endpointSyncQueryKeyFromBlock = "fromBlock"
-	endpointAddPeer               = "/node/peer"
-	endpointAddPeerQueryKeyIP     = "ip"
-	endpointAddPeerQueryKeyPort   = "port"
-	endpointAddPeerQueryKeyMiner  = "miner"
+	// DefaultMinTrxFee is the default lowest fee of a pending transaction.
+	DefaultMinTrxFee = 1
+
+	endpointBalances                = "/balances/list"
+	endpointBalancesQueryKeyHeight  = "height"
+	endpointBalancesQueryKeyBlock   = "block"
+	endpointBalancesQueryKeyAccount = "account"
+	endpointPostTrx                 = "POST /trx/add"
+	endpointSubmitTrx               = "POST /trx/submit"
+	endpointStatus                  = "/node/status"
+	endpointSync                    = "/node/sync"
+	endpointSyncQueryKeyFromBlock   = "fromBlock"
+	endpointAddPeer                 = "/node/peer"
+	endpointAddPeerQueryKeyIP       = "ip"
+	endpointAddPeerQueryKeyPort     = "port"
+	endpointAddPeerQueryKeyMiner    = "miner"
+	endpointAccountNonce            = "GET /accounts/{account}/nonce"
+	endpointAccountHistory          = "GET /accounts/{account}/history"
+	endpointAccountPathKey          = "account"
+	endpointHistoryQueryKeyOffset   = "offset"
+	endpointHistoryQueryKeyLimit    = "limit"
+	endpointBalanceProof            = "GET /balances/{account}/proof"
+	endpointTrx                     = "GET /trx/{hash}"
+	endpointTrxProof                = "GET /trx/{hash}/proof"
+	endpointTrxPathKey              = "hash"
+	endpointTrxProofQueryKeyBlock   = "block"
+	endpointBlock                   = "GET /blocks/{ref}"
+	endpointBlockPathKey            = "ref"
+	endpointBlocks                  = "GET /blocks"
+	endpointBlocksQueryKeyFrom      = "from"
+	endpointBlocksQueryKeyTo        = "to"
+
+	// DefaultHistoryLimit is the default history page size.
+	DefaultHistoryLimit = 100
+	maxHistoryLimit     = 1000
+
+	// MaxBlocksPerRes is the most blocks listed in one response.
+	MaxBlocksPerRes = 100
+
+	// maxSyncBlocks is the most blocks a peer is sent per sync request.
+	maxSyncBlocks = 10
+
+	// blockSizeSlack covers the RLP length prefixes growing with a block.
+	blockSizeSlack = 16
 
 	mininingIntervalSeconds = 10
 )
 
 type (
 	Node struct {
-		info PeerNode
+		info      PeerNode
+		minTrxFee uint64
 
 		state           state
 		knownPeers      map[string]PeerNode
@@ -56,7 +94,25 @@ type (
 		LatestBlock() db.Block
 		LatestBlockHash() db.Hash
 		NextBlockHeight() uint64
+		ChainWork() uint64
+		NextBlockDifficulty() uint64
+		PendingStateRoot(common.Address, []db.SignedTrx) (db.Hash, error)
+		BalanceProof(common.Address) db.StateProof
 		Balances() map[common.Address]uint64
+		BalancesAt(uint64) (map[common.Address]uint64, db.Hash, error)
+		BalancesAtHash(db.Hash) (map[common.Address]uint64, error)
+		GetNextAccountNonce(common.Address) uint64
+		GetBlockByHeight(uint64) (db.BlockFS, error)
+		GetBlockByHash(db.Hash) (db.BlockFS, error)
+		GetBlockByRef(string) (db.BlockFS, error)
+		GetBlocks(uint64, uint64) ([]db.Block, error)
+		GetTrx(db.Hash) (db.SignedTrx, db.TrxLocation, error)
+		Confirmations(uint64) uint64
+		AccountHistory(common.Address, uint64, uint64) ([]db.HistoryEntry, uint64, error)
+		GetBlocksAfter(db.Hash, uint64) ([]db.Block, error)
+		TakeOrphanedTRXs() []db.SignedTrx
+		FirstBlockHeight() uint64
+		ChainID() string
 		DataDir() string
 	}
 	PeerNode struct {
@@ -69,13 +125,14 @@ type (
 	}
 )
 
-func New(s state, ip string, port uint64, acc common.Address, bootstrap PeerNode) *Node {
+func New(s state, ip string, port uint64, acc common.Address, bootstrap PeerNode, minTrxFee uint64) *Node {
 	knownPeers := map[string]PeerNode{
 		bootstrap.Address(): bootstrap,
 	}
 	return &Node{
-		info:  NewPeerNode(ip, port, false, acc, true),
-		state: s,
+		info:      NewPeerNode(ip, port, false, acc, true),
+		minTrxFee: minTrxFee,
+		state:     s,
 
 		knownPeers:      knownPeers,
 		pendingTRXs:     make(map[string]db.SignedTrx),
@@ -95,9 +152,17 @@ func (n *Node) Run(ctx context.Context) error {
 
 	mx.HandleFunc(endpointBalances, n.GetBalances)
 	mx.HandleFunc(endpointPostTrx, n.PostTrx)
+	mx.HandleFunc(endpointSubmitTrx, n.SubmitTrx)
 	mx.HandleFunc(endpointStatus, n.Status)
 	mx.HandleFunc(endpointSync, n.Sync)
 	mx.HandleFunc(endpointAddPeer, n.AddPeer)
+	mx.HandleFunc(endpointAccountNonce, n.AccountNonce)
+	mx.HandleFunc(endpointAccountHistory, n.AccountHistory)
+	mx.HandleFunc(endpointBalanceProof, n.BalanceProof)
+	mx.HandleFunc(endpointTrx, n.Trx)
+	mx.HandleFunc(endpointTrxProof, n.TrxProof)
+	mx.HandleFunc(endpointBlock, n.Block)
+	mx.HandleFunc(endpointBlocks, n.Blocks)
 
 	go func() {
 		if err := n.sync(context.Background()); err != nil {
@@ -116,7 +181,7 @@ func (n *Node) Run(ctx context.Context) error {
 	fmt.Printf("	- height: %d\n", n.state.LatestBlock().Header.Height)
 	fmt.Printf("	- hash: %s\n", n.state.LatestBlockHash().Hex())
 
-	server := &http.Server{Addr: fmt.Sprintf(":%d", n.info.Port)}
+	server := &http.Server{Addr: fmt.Sprintf(":%d", n.info.Port), Handler: mx}
 
 	go func() {
 		<-ctx.Done()
@@ -134,11 +199,50 @@ func (n *Node) LatestBlockHash() db.Hash {
 	return n.state.LatestBlockHash()
 }
 
+// GetBalances lists the balances as of the latest or the requested block.
 func (n *Node) GetBalances(w http.ResponseWriter, r *http.Request) {
-	res := BalanceRes{
-		n.state.LatestBlockHash(),
-		n.state.Balances(),
+	query := r.URL.Query()
+
+	res := BalanceRes{n.state.LatestBlockHash(), n.state.Balances()}
+
+	switch {
+	case query.Has(endpointBalancesQueryKeyHeight):
+		height, err := parseUintQuery(r, endpointBalancesQueryKeyHeight, 0)
+		if err != nil {
+			writeErr(w, err)
+			return
+		}
+
+		res.Balances, res.Hash, err = n.state.BalancesAt(height)
+		if err != nil {
+			writeErr(w, err)
+			return
+		}
+	case query.Has(endpointBalancesQueryKeyBlock):
+		if err := res.Hash.UnmarshalText([]byte(query.Get(endpointBalancesQueryKeyBlock))); err != nil {
+			writeErr(w, err)
+			return
+		}
+
+		var err error
+		res.Balances, err = n.state.BalancesAtHash(res.Hash)
+		if err != nil {
+			writeErr(w, err)
+			return
+		}
+	}
+
+	if query.Has(endpointBalancesQueryKeyAccount) {
+		accountRaw := query.Get(endpointBalancesQueryKeyAccount)
+		if !common.IsHexAddress(accountRaw) {
+			writeErr(w, fmt.Errorf("%s is an invalid account", accountRaw))
+			return
+		}
+
+		account := db.NewAccount(accountRaw)
+		res.Balances = map[common.Address]uint64{account: res.Balances[account]}
 	}
+
 	writeRes(w, res)
 }
 
@@ -160,9 +264,14 @@ func (n *Node) PostTrx(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	trx := db.NewTrx(from, db.NewAccount(req.To), req.Value, req.Data)
+	fee := req.Fee
+	if fee == 0 {
+		fee = n.minTrxFee
+	}
+
+	trx := db.NewTrx(from, db.NewAccount(req.To), req.Value, fee, n.getNextAccountNonce(from), req.Data)
 
-	signedTrx, err := wallet.SignTrxWithKeystoreAccount(trx, from, req.FromPwd, wallet.GetKeystoreDirPath(n.state.DataDir()))
+	signedTrx, err := wallet.SignTrxWithKeystoreAccount(trx, from, req.FromPwd, wallet.GetKeystoreDirPath(n.state.DataDir()), n.state.ChainID())
 	if err != nil {
 		writeErr(w, err)
 		return
@@ -173,18 +282,54 @@ func (n *Node) PostTrx(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := n.AddPendingTrx(signedTrx, n.info); err != nil {
+	writeRes(w, TrxPostRes{Success: true})
+}
+
+// SubmitTrx adds already signed transactions to the pending ones.
+func (n *Node) SubmitTrx(w http.ResponseWriter, r *http.Request) {
+	var trxs []db.SignedTrx
+	if err := readReq(r, &trxs); err != nil {
 		writeErr(w, err)
 		return
 	}
 
-	writeRes(w, TrxPostRes{Success: true})
+	res := TrxSubmitRes{Accepted: make([]db.Hash, 0), Rejected: make([]TrxRejection, 0)}
+	for _, trx := range trxs {
+		trxHash, err := trx.Hash()
+		if err == nil {
+			err = n.submitTrx(trx)
+		}
+
+		if err != nil {
+			res.Rejected = append(res.Rejected, TrxRejection{trxHash, err.Error()})
+			continue
+		}
+		res.Accepted = append(res.Accepted, trxHash)
+	}
+
+	writeRes(w, res)
+}
+
+// submitTrx adds a signed transaction to the pending ones.
+func (n *Node) submitTrx(trx db.SignedTrx) error {
+	ok, err := trx.IsAuthentic(n.state.ChainID())
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("wrong transaction. Sender '%s' is forged", trx.From.String())
+	}
+
+	return n.AddPendingTrx(trx, n.info)
 }
 
 func (n *Node) Status(w http.ResponseWriter, r *http.Request) {
 	res := StatusRes{
+		ChainID:     n.state.ChainID(),
 		Hash:        n.state.LatestBlockHash(),
 		Height:      n.state.LatestBlock().Header.Height,
+		ChainWork:   n.state.ChainWork(),
+		FirstHeight: n.state.FirstBlockHeight(),
 		KnownPeers:  n.knownPeers,
 		PendingTRXs: n.getPendingTRXsAsArray(),
 	}
@@ -201,13 +346,20 @@ func (n *Node) Sync(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	blocks, err := db.GetBlocksAfter(hash, n.state.DataDir())
-	if err != nil {
+	blocks, err := n.state.GetBlocksAfter(hash, maxSyncBlocks)
+	var pruned db.ErrBlockPruned
+	if errors.As(err, &pruned) {
+		blocks = make([]db.Block, 0)
+	} else if err != nil {
 		writeErr(w, err)
 		return
 	}
 
-	writeRes(w, SyncRes{Blocks: blocks})
+	writeNegotiatedRes(w, r, SyncRes{
+		Blocks:      blocks,
+		FirstHeight: n.state.FirstBlockHeight(),
+		LastHeight:  n.state.LatestBlock().Header.Height,
+	})
 }
 
 func (n *Node) AddPeer(w http.ResponseWriter, r *http.Request) {
@@ -231,6 +383,180 @@ func (n *Node) AddPeer(w http.ResponseWriter, r *http.Request) {
 	writeRes(w, AddPeerRes{true, ""})
 }
 
+func (n *Node) AccountNonce(w http.ResponseWriter, r *http.Request) {
+	accountRaw := r.PathValue(endpointAccountPathKey)
+	if !common.IsHexAddress(accountRaw) {
+		writeErr(w, fmt.Errorf("%s is an invalid account", accountRaw))
+		return
+	}
+
+	account := db.NewAccount(accountRaw)
+	writeRes(w, NonceRes{account, n.getNextAccountNonce(account)})
+}
+
+// AccountHistory returns a page of an account's history.
+func (n *Node) AccountHistory(w http.ResponseWriter, r *http.Request) {
+	accountRaw := r.PathValue(endpointAccountPathKey)
+	if !common.IsHexAddress(accountRaw) {
+		writeErr(w, fmt.Errorf("%s is an invalid account", accountRaw))
+		return
+	}
+
+	offset, err := parseUintQuery(r, endpointHistoryQueryKeyOffset, 0)
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+
+	limit, err := parseUintQuery(r, endpointHistoryQueryKeyLimit, DefaultHistoryLimit)
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	limit = min(limit, maxHistoryLimit)
+
+	account := db.NewAccount(accountRaw)
+	entries, total, err := n.state.AccountHistory(account, offset, limit)
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+
+	writeRes(w, HistoryRes{account, total, offset, entries})
+}
+
+// BalanceProof returns an account's balance and nonce with a state proof.
+func (n *Node) BalanceProof(w http.ResponseWriter, r *http.Request) {
+	accountRaw := r.PathValue(endpointAccountPathKey)
+	if !common.IsHexAddress(accountRaw) {
+		writeErr(w, fmt.Errorf("%s is an invalid account", accountRaw))
+		return
+	}
+
+	latestBlock := n.state.LatestBlock()
+	res := BalanceProofRes{
+		Hash:      n.state.LatestBlockHash(),
+		StateRoot: latestBlock.Header.StateRoot,
+		Proof:     n.state.BalanceProof(db.NewAccount(accountRaw)),
+	}
+	writeRes(w, res)
+}
+
+// Trx looks up a mined transaction and the block it was mined in.
+func (n *Node) Trx(w http.ResponseWriter, r *http.Request) {
+	var trxHash db.Hash
+	if err := trxHash.UnmarshalText([]byte(r.PathValue(endpointTrxPathKey))); err != nil {
+		writeErr(w, err)
+		return
+	}
+
+	trx, location, err := n.state.GetTrx(trxHash)
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+
+	writeRes(w, TrxRes{trxHash, trx, location, n.state.Confirmations(location.BlockHeight)})
+}
+
+// TrxProof returns the Merkle proof of a transaction's inclusion in a block,
+// along with the block header.
+func (n *Node) TrxProof(w http.ResponseWriter, r *http.Request) {
+	var trxHash db.Hash
+	if err := trxHash.UnmarshalText([]byte(r.PathValue(endpointTrxPathKey))); err != nil {
+		writeErr(w, err)
+		return
+	}
+
+	var blockHash db.Hash
+	if err := blockHash.UnmarshalText([]byte(r.URL.Query().Get(endpointTrxProofQueryKeyBlock))); err != nil {
+		writeErr(w, err)
+		return
+	}
+
+	if blockHash.IsEmpty() {
+		_, location, err := n.state.GetTrx(trxHash)
+		if err != nil {
+			writeErr(w, err)
+			return
+		}
+		blockHash = location.BlockHash
+	}
+
+	blockFS, err := n.state.GetBlockByHash(blockHash)
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+
+	proof, err := blockFS.Value.TrxProof(trxHash)
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+
+	writeRes(w, TrxProofRes{blockFS.Key, blockFS.Value.Header, proof})
+}
+
+// Block looks up a block by its height or hash.
+func (n *Node) Block(w http.ResponseWriter, r *http.Request) {
+	blockFS, err := n.state.GetBlockByRef(r.PathValue(endpointBlockPathKey))
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+
+	res, err := NewBlockRes(blockFS.Key, blockFS.Value, n.state.Confirmations(blockFS.Value.Header.Height))
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+
+	writeRes(w, res)
+}
+
+// Blocks lists the blocks from the 'from' height to the 'to' height.
+func (n *Node) Blocks(w http.ResponseWriter, r *http.Request) {
+	from, err := parseUintQuery(r, endpointBlocksQueryKeyFrom, 0)
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+
+	to, err := parseUintQuery(r, endpointBlocksQueryKeyTo, n.state.LatestBlock().Header.Height)
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	if from <= to && to-from >= MaxBlocksPerRes {
+		to = from + MaxBlocksPerRes - 1
+	}
+
+	blocks, err := n.state.GetBlocks(from, to)
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+
+	res := BlocksRes{make([]BlockRes, 0, len(blocks))}
+	for _, block := range blocks {
+		blockHash, err := block.Hash()
+		if err != nil {
+			writeErr(w, err)
+			return
+		}
+
+		blockRes, err := NewBlockRes(blockHash, block, n.state.Confirmations(block.Header.Height))
+		if err != nil {
+			writeErr(w, err)
+			return
+		}
+		res.Blocks = append(res.Blocks, blockRes)
+	}
+
+	writeRes(w, res)
+}
+
 func (n *Node) AddPendingTrx(trx db.SignedTrx, fromPeer PeerNode) error {
 	trxHash, err := trx.Hash()
 	if err != nil {
@@ -245,12 +571,30 @@ func (n *Node) AddPendingTrx(trx db.SignedTrx, fromPeer PeerNode) error {
 	_, isAlreadyPending := n.pendingTRXs[trxHash.Hex()]
 	_, isArchived := n.archivedTRXs[trxHash.Hex()]
 
-	if !isAlreadyPending && !isArchived {
-		fmt.Printf("[%s]- added pending transaction %s from peer %s\n", n.info.Address(), trxJSON, fromPeer.Address())
-		n.pendingTRXs[trxHash.Hex()] = trx
-		n.newPendingTRXs <- trx
+	if isAlreadyPending || isArchived {
+		return nil
 	}
 
+	if nextNonce := n.state.GetNextAccountNonce(trx.From); trx.Nonce < nextNonce {
+		return db.NewInvalidNonce(trx.From, nextNonce, trx.Nonce)
+	}
+
+	if err := trx.CheckLimits(); err != nil {
+		return err
+	}
+
+	if trx.Fee < n.minTrxFee {
+		return db.NewFeeTooLow(n.minTrxFee, trx.Fee)
+	}
+
+	if maxTime := db.MaxAllowedTime(); trx.Time > maxTime {
+		return db.NewTrxInFuture(trx.Time, maxTime)
+	}
+
+	fmt.Printf("[%s]- added pending transaction %s from peer %s\n", n.info.Address(), trxJSON, fromPeer.Address())
+	n.pendingTRXs[trxHash.Hex()] = trx
+	n.newPendingTRXs <- trx
+
 	return nil
 }
 
@@ -312,11 +656,20 @@ func (n *Node) mine(ctx context.Context) error {
 }
 
 func (n *Node) minePendingTRXs(ctx context.Context) error {
+	trxs := n.selectPendingTRXs(db.MaxBlockTRXs, db.MaxBlockSize)
+
+	stateRoot, err := n.state.PendingStateRoot(n.info.Account, trxs)
+	if err != nil {
+		return err
+	}
+
 	blockToMine := NewPendingBlock(
 		n.state.LatestBlockHash(),
-		n.state.LatestBlock().Header.Height+1,
+		n.state.NextBlockHeight(),
+		n.state.NextBlockDifficulty(),
 		n.info.Account,
-		n.getPendingTRXsAsArray(),
+		stateRoot,
+		trxs,
 	)
 
 	minedBlock, err := Mine(ctx, blockToMine)
@@ -330,10 +683,26 @@ func (n *Node) minePendingTRXs(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
+	n.pendOrphanedTRXs()
 
 	return nil
 }
 
+// pendOrphanedTRXs pends the transactions of replaced blocks again.
+func (n *Node) pendOrphanedTRXs() {
+	for _, trx := range n.state.TakeOrphanedTRXs() {
+		trxHash, err := trx.Hash()
+		if err != nil {
+			continue
+		}
+
+		delete(n.archivedTRXs, trxHash.Hex())
+		if err := n.AddPendingTrx(trx, n.info); err != nil {
+			fmt.Printf("dropping transaction %s of a replaced block: %v\n", trxHash.Hex(), err)
+		}
+	}
+}
+
 func (n *Node) removeMinedPendingTRXs(block db.Block) {
 	if len(block.TRXs) > 0 && len(n.pendingTRXs) > 0 {
 		fmt.Println("Updating in-memory pending transaction pool:")
@@ -350,6 +719,93 @@ func (n *Node) removeMinedPendingTRXs(block db.Block) {
 	}
 }
 
+// getNextAccountNonce returns the nonce following the account's confirmed
+// and pending transactions.
+func (n *Node) getNextAccountNonce(account common.Address) uint64 {
+	nonce := n.state.GetNextAccountNonce(account)
+
+	for _, trx := range n.pendingTRXs {
+		if trx.From == account && trx.Nonce >= nonce {
+			nonce = trx.Nonce + 1
+		}
+	}
+
+	return nonce
+}
+
+// selectPendingTRXs picks the highest paying pending transactions fitting
+// in a block, taking each sender's transactions in nonce order.
+func (n *Node) selectPendingTRXs(maxTRXs, maxSize int) []db.SignedTrx {
+	now := uint64(time.Now().UnixNano())
+
+	// Start from the largest possible empty block.
+	size, _ := db.Block{Header: db.BlockHeader{
+		Height:     math.MaxUint64,
+		Difficulty: math.MaxUint64,
+		Nonce:      math.MaxUint32,
+		Time:       math.MaxUint64,
+	}}.Size()
+	size += blockSizeSlack
+
+	queues := make(map[common.Address][]db.SignedTrx)
+	for _, trx := range n.pendingTRXs {
+		queues[trx.From] = append(queues[trx.From], trx)
+	}
+
+	spent := make(map[common.Address]uint64)
+	for from, queue := range queues {
+		sort.Slice(queue, func(i, j int) bool {
+			return queue[i].Nonce < queue[j].Nonce
+		})
+
+		nonce := n.state.GetNextAccountNonce(from)
+		var i int
+		for ; i < len(queue) && queue[i].Nonce == nonce && queue[i].Time <= now; i++ {
+			nonce++
+		}
+		queues[from] = queue[:i]
+	}
+
+	trxs := make([]db.SignedTrx, 0)
+	for len(trxs) < maxTRXs {
+		var (
+			best  common.Address
+			found bool
+		)
+		for from, queue := range queues {
+			if len(queue) == 0 {
+				continue
+			}
+			if !found || queue[0].Fee > queues[best][0].Fee ||
+				(queue[0].Fee == queues[best][0].Fee && queue[0].Time < queues[best][0].Time) {
+				best, found = from, true
+			}
+		}
+		if !found {
+			break
+		}
+
+		trx := queues[best][0]
+		if trx.Cost() < trx.Value || spent[best]+trx.Cost() > n.state.Balances()[best] {
+			delete(queues, best)
+			continue
+		}
+
+		trxSize, err := trx.Size()
+		if err != nil || size+trxSize > maxSize {
+			delete(queues, best)
+			continue
+		}
+
+		size += trxSize
+		spent[best] += trx.Cost()
+		trxs = append(trxs, trx)
+		queues[best] = queues[best][1:]
+	}
+
+	return trxs
+}
+
 func (n *Node) getPendingTRXsAsArray() []db.SignedTrx {
 	trxs := make([]db.SignedTrx, len(n.pendingTRXs))
 
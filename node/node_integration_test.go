@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
 	"path/filepath"
 	"testing"
@@ -54,12 +55,37 @@ func TestNode_Run(t *testing.T) {
 		t.Fatalf("error creating new state from disk: %v", err)
 	}
 
-	n := New(s, DefaultIP, DefaultHTTPort, db.NewAccount(wallet.AndrejAccount), PeerNode{})
+	n := New(s, DefaultIP, DefaultHTTPort, db.NewAccount(wallet.AndrejAccount), PeerNode{}, DefaultMinTrxFee)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	if err := n.Run(ctx); err != nil {
+	errC := make(chan error, 1)
+	go func() {
+		errC <- n.Run(ctx)
+	}()
+
+	statusURL := fmt.Sprintf("http://%s:%d%s", DefaultIP, DefaultHTTPort, endpointStatus)
+	var res *http.Response
+	for i := 0; i < 20; i++ {
+		if res, err = http.Get(statusURL); err == nil {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("error requesting node status: %v", err)
+	}
+
+	var status StatusRes
+	if err := readRes(res, &status); err != nil {
+		t.Fatalf("error reading node status: %v", err)
+	}
+	if status.Hash != s.LatestBlockHash() {
+		t.Errorf("node status should report the latest block %s not %s", s.LatestBlockHash().Hex(), status.Hash.Hex())
+	}
+
+	if err := <-errC; err != nil {
 		t.Errorf("expected node to shutdown after 5 seconds")
 	}
 }
@@ -83,7 +109,7 @@ func TestNode_Mining(t *testing.T) {
 		t.Fatalf("error getting new state from disk: %v", err)
 	}
 
-	n := New(s, pn.IP, pn.Port, andrej, pn)
+	n := New(s, pn.IP, pn.Port, andrej, pn, DefaultMinTrxFee)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
 	defer cancel()
@@ -95,8 +121,8 @@ func TestNode_Mining(t *testing.T) {
 	// because the n.Run() few lines below is a blocking call
 	go func() {
 		time.Sleep((mininingIntervalSeconds / 3) * time.Second)
-		trx := db.NewTrx(andrej, babayaga, 1, "")
-		signedTrx, err := wallet.SignTrxWithKeystoreAccount(trx, andrej, testKsAccountsPwd, wallet.GetKeystoreDirPath(dataDir))
+		trx := db.NewTrx(andrej, babayaga, 1, DefaultMinTrxFee, 1, "")
+		signedTrx, err := wallet.SignTrxWithKeystoreAccount(trx, andrej, testKsAccountsPwd, wallet.GetKeystoreDirPath(dataDir), s.ChainID())
 		if err != nil {
 			errC <- fmt.Errorf("error creating new signed transaction: %v", err)
 		}
@@ -106,8 +132,8 @@ func TestNode_Mining(t *testing.T) {
 	// that it came in - while the first TX is being mined
 	go func() {
 		time.Sleep((mininingIntervalSeconds + 2) * time.Second)
-		trx := db.NewTrx(andrej, babayaga, 2, "")
-		signedTrx, err := wallet.SignTrxWithKeystoreAccount(trx, andrej, testKsAccountsPwd, wallet.GetKeystoreDirPath(dataDir))
+		trx := db.NewTrx(andrej, babayaga, 2, DefaultMinTrxFee, 2, "")
+		signedTrx, err := wallet.SignTrxWithKeystoreAccount(trx, andrej, testKsAccountsPwd, wallet.GetKeystoreDirPath(dataDir), s.ChainID())
 		if err != nil {
 			errC <- fmt.Errorf("error creating new signed transaction: %v", err)
 		}
@@ -204,20 +230,20 @@ func TestNode_MiningStopsOnNewSyncedBlock(t *testing.T) {
 		true,
 	)
 
-	n := New(s, pn.IP, pn.Port, babayaga, pn)
+	n := New(s, pn.IP, pn.Port, babayaga, pn, DefaultMinTrxFee)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
 	defer cancel()
 
-	trx1 := db.NewTrx(andrej, babayaga, 1, "")
-	trx2 := db.NewTrx(andrej, babayaga, 2, "")
+	trx1 := db.NewTrx(andrej, babayaga, 1, DefaultMinTrxFee, 1, "")
+	trx2 := db.NewTrx(andrej, babayaga, 2, DefaultMinTrxFee, 2, "")
 
-	signedTrx1, err := wallet.SignTrxWithKeystoreAccount(trx1, andrej, testKsAccountsPwd, wallet.GetKeystoreDirPath(dataDir))
+	signedTrx1, err := wallet.SignTrxWithKeystoreAccount(trx1, andrej, testKsAccountsPwd, wallet.GetKeystoreDirPath(dataDir), s.ChainID())
 	if err != nil {
 		t.Fatalf("error signing transaction 1 for andrej: %v", err)
 	}
 
-	signedTrx2, err := wallet.SignTrxWithKeystoreAccount(trx1, andrej, testKsAccountsPwd, wallet.GetKeystoreDirPath(dataDir))
+	signedTrx2, err := wallet.SignTrxWithKeystoreAccount(trx1, andrej, testKsAccountsPwd, wallet.GetKeystoreDirPath(dataDir), s.ChainID())
 	if err != nil {
 		t.Fatalf("error signing transaction 2 for babyaga: %v", err)
 	}
@@ -228,7 +254,12 @@ func TestNode_MiningStopsOnNewSyncedBlock(t *testing.T) {
 		cancel()
 	}
 
-	validPreMinedPb := NewPendingBlock(db.Hash{}, 0, andrej, []db.SignedTrx{signedTrx1})
+	stateRoot, err := s.PendingStateRoot(andrej, []db.SignedTrx{signedTrx1})
+	if err != nil {
+		t.Fatalf("error computing state root: %v", err)
+	}
+
+	validPreMinedPb := NewPendingBlock(db.Hash{}, 0, s.NextBlockDifficulty(), andrej, stateRoot, []db.SignedTrx{signedTrx1})
 	validSyncedBlock, err := Mine(ctx, validPreMinedPb)
 	if err != nil {
 		t.Fatalf("error mining block: %v", err)
@@ -304,8 +335,9 @@ func TestNode_MiningStopsOnNewSyncedBlock(t *testing.T) {
 		endAndrejBalance := n.state.Balances()[andrej]
 		endBabayagaBalance := n.state.Balances()[babayaga]
 
-		expectedEndAndrejBalance := startingAndrejBalance - trx1.Value - trx2.Value + db.BlockReward
-		expectedEndBabayagaBalance := startingBabayagaBalance + trx1.Value + trx2.Value + db.BlockReward
+		// Andrej's account mined trx1, so its fee returns to it.
+		expectedEndAndrejBalance := startingAndrejBalance - trx1.Value - trx2.Value - trx2.Fee + db.BlockReward
+		expectedEndBabayagaBalance := startingBabayagaBalance + trx1.Value + trx2.Value + trx2.Fee + db.BlockReward
 
 		if endAndrejBalance != expectedEndAndrejBalance {
 			errC <- fmt.Errorf("Andrej expected balance is %d not %d", expectedEndAndrejBalance, endAndrejBalance)
@@ -2,6 +2,7 @@ package node
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
@@ -44,6 +45,12 @@ func (n *Node) doSync() {
 			continue
 		}
 
+		if status.ChainID != n.state.ChainID() {
+			fmt.Printf("Peer %s runs chain '%s' instead of '%s' and was removed from known peers\n", peer.Address(), status.ChainID, n.state.ChainID())
+			n.deletePeer(peer)
+			continue
+		}
+
 		if err := n.joinKnownPeers(peer); err != nil {
 			fmt.Println("ERROR:", err)
 			continue
@@ -67,45 +74,97 @@ func (n *Node) doSync() {
 	}
 }
 
+// syncBlocks fetches the peer's chain when it carries more work.
 func (n *Node) syncBlocks(p PeerNode, status StatusRes) error {
-	localBlockHeight := n.state.LatestBlock().Header.Height
-
-	if status.Hash.IsEmpty() {
-		return nil
-	}
-
-	if status.Height < localBlockHeight {
+	if status.Hash.IsEmpty() || status.Hash == n.state.LatestBlockHash() {
 		return nil
 	}
 
-	if status.Height == 0 && !n.state.LatestBlockHash().IsEmpty() {
+	localWork := n.state.ChainWork()
+	if status.ChainWork <= localWork {
 		return nil
 	}
 
-	newBlocksCount := status.Height - localBlockHeight
-	if localBlockHeight == 0 && status.Height == 0 {
-		newBlocksCount = 1
-	}
-
-	fmt.Println("Found", newBlocksCount, "new blocks from peer:", p.Address())
+	fmt.Println("Found a chain with more work from peer:", p.Address(), status.ChainWork, ">", localWork)
 
-	if newBlocksCount == 0 {
+	if status.FirstHeight > n.state.NextBlockHeight() {
+		fmt.Println("Peer", p.Address(), "pruned its blocks below height", status.FirstHeight, "skipping")
 		return nil
 	}
 
-	blocks, err := fetchBlocksFromPeer(p, n.state.LatestBlockHash())
+	blocks, err := n.fetchNewBlocksFromPeer(p)
 	if err != nil {
 		return err
 	}
 
-	for _, block := range blocks {
-		if _, err = n.state.AddBlock(block); err != nil {
+	for {
+		for _, block := range blocks {
+			_, err = n.state.AddBlock(block)
+
+			var exists db.ErrBlockExists
+			if errors.As(err, &exists) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			n.pendOrphanedTRXs()
+
+			n.newSyncedBlocks <- block
+		}
+
+		// A full page means the peer may have more blocks to send.
+		if len(blocks) != maxSyncBlocks {
+			return nil
+		}
+
+		lastHash, err := blocks[len(blocks)-1].Hash()
+		if err != nil {
 			return err
 		}
-		n.newSyncedBlocks <- block
+
+		syncRes, err := fetchBlocksFromPeer(p, lastHash)
+		if err != nil {
+			return err
+		}
+		blocks = syncRes.Blocks
 	}
+}
 
-	return nil
+// fetchNewBlocksFromPeer fetches the peer's blocks following the latest
+// block both chains share, trying exponentially older local blocks.
+func (n *Node) fetchNewBlocksFromPeer(p PeerNode) ([]db.Block, error) {
+	fromBlock := n.state.LatestBlockHash()
+	height := n.state.LatestBlock().Header.Height
+	step := uint64(1)
+
+	for {
+		syncRes, err := fetchBlocksFromPeer(p, fromBlock)
+
+		var statusErr errPeerStatus
+		if !errors.As(err, &statusErr) || statusErr.status != http.StatusNotFound || fromBlock.IsEmpty() {
+			if err == nil && len(syncRes.Blocks) == 0 && syncRes.FirstHeight > 0 {
+				return nil, fmt.Errorf("peer %s only serves blocks from height %d", p.Address(), syncRes.FirstHeight)
+			}
+			return syncRes.Blocks, err
+		}
+
+		if height < step {
+			fromBlock = db.Hash{}
+			continue
+		}
+
+		height -= step
+		step *= 2
+
+		blockFS, err := n.state.GetBlockByHeight(height)
+		if err != nil {
+			return nil, err
+		}
+		fromBlock = blockFS.Key
+
+		fmt.Println("Peer", p.Address(), "is on a fork, looking for a common ancestor at height", height)
+	}
 }
 
 func (n *Node) syncKnownPeers(status StatusRes) error {
@@ -121,7 +180,21 @@ func (n *Node) syncKnownPeers(status StatusRes) error {
 
 func (n *Node) syncPendingTRXs(p PeerNode, trxs []db.SignedTrx) error {
 	for _, trx := range trxs {
-		if err := n.AddPendingTrx(trx, p); err != nil {
+		err := n.AddPendingTrx(trx, p)
+
+		// The peer may still list transactions already mined by a synced block.
+		var invalidNonce db.ErrInvalidNonce
+		if errors.As(err, &invalidNonce) {
+			continue
+		}
+
+		// Peers may accept lower fees, and their clocks may run ahead.
+		var feeTooLow db.ErrFeeTooLow
+		var trxInFuture db.ErrTrxInFuture
+		if errors.As(err, &feeTooLow) || errors.As(err, &trxInFuture) {
+			continue
+		}
+		if err != nil {
 			return err
 		}
 	}
@@ -184,7 +257,7 @@ func queryPeerStatus(peer PeerNode) (StatusRes, error) {
 	return statusRes, nil
 }
 
-func fetchBlocksFromPeer(p PeerNode, fromBlock db.Hash) ([]db.Block, error) {
+func fetchBlocksFromPeer(p PeerNode, fromBlock db.Hash) (SyncRes, error) {
 	fmt.Println("Importing blocks...")
 
 	url := fmt.Sprintf(
@@ -195,16 +268,23 @@ func fetchBlocksFromPeer(p PeerNode, fromBlock db.Hash) ([]db.Block, error) {
 		fromBlock.Hex(),
 	)
 
-	res, err := http.Get(url)
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return SyncRes{}, err
+	}
+	// Peers predating the binary encoding answer in JSON.
+	req.Header.Set("Accept", contentTypeRLP+", "+contentTypeJSON)
+
+	res, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return nil, err
+		return SyncRes{}, err
 	}
 
 	var syncRes SyncRes
 	err = readRes(res, &syncRes)
 	if err != nil {
-		return nil, err
+		return SyncRes{}, err
 	}
 
-	return syncRes.Blocks, nil
+	return syncRes, nil
 }
@@ -32,34 +32,45 @@ func NewKeystoreAccount(dataDir, password string) (common.Address, error) {
 
 func SignTrxWithKeystoreAccount(
 	trx db.Trx, acc common.Address,
-	pwd, keystoreDir string,
+	pwd, keystoreDir, chainID string,
 ) (db.SignedTrx, error) {
-	ks := keystore.NewKeyStore(keystoreDir, keystore.StandardScryptN, keystore.StandardScryptP)
-	ksAccount, err := ks.Find(accounts.Account{Address: acc})
+	privKey, err := DecryptKeystoreAccount(acc, pwd, keystoreDir)
 	if err != nil {
 		return db.SignedTrx{}, err
 	}
 
-	ksAccountJson, err := fs.AppFS.ReadFile(ksAccount.URL.Path)
+	signedTrx, err := SignTrx(trx, chainID, privKey)
 	if err != nil {
 		return db.SignedTrx{}, err
 	}
 
-	key, err := keystore.DecryptKey(ksAccountJson, pwd)
+	return signedTrx, nil
+}
+
+// DecryptKeystoreAccount returns the private key of a keystore account.
+func DecryptKeystoreAccount(acc common.Address, pwd, keystoreDir string) (*ecdsa.PrivateKey, error) {
+	ks := keystore.NewKeyStore(keystoreDir, keystore.StandardScryptN, keystore.StandardScryptP)
+	ksAccount, err := ks.Find(accounts.Account{Address: acc})
 	if err != nil {
-		return db.SignedTrx{}, err
+		return nil, err
 	}
 
-	signedTrx, err := SignTrx(trx, key.PrivateKey)
+	ksAccountJson, err := fs.AppFS.ReadFile(ksAccount.URL.Path)
 	if err != nil {
-		return db.SignedTrx{}, err
+		return nil, err
 	}
 
-	return signedTrx, nil
+	key, err := keystore.DecryptKey(ksAccountJson, pwd)
+	if err != nil {
+		return nil, err
+	}
+
+	return key.PrivateKey, nil
 }
 
-func SignTrx(tx db.Trx, privKey *ecdsa.PrivateKey) (db.SignedTrx, error) {
-	rawTx, err := tx.Encode()
+// SignTrx signs the transaction for the chain identified by chainID.
+func SignTrx(tx db.Trx, chainID string, privKey *ecdsa.PrivateKey) (db.SignedTrx, error) {
+	rawTx, err := tx.SigningPayload(chainID)
 	if err != nil {
 		return db.SignedTrx{}, err
 	}
@@ -16,11 +16,14 @@ import (
 	"github.com/marc-watters/the-block-chain-bar/v2/fs"
 )
 
-// The password for testing keystore files:
-//
-//	./node/test_andrej--3eb92807f1f91a8d4d85bc908c7f86dcddb1df57
-//	./node/test_babayaga--6fdc0d8d15ae6b4ebf45c52fd2aafbcbb19a65c8
-const testKeystoreAccountsPwd = "security123"
+const (
+	// The password for testing keystore files:
+	//
+	//	./node/test_andrej--3eb92807f1f91a8d4d85bc908c7f86dcddb1df57
+	//	./node/test_babayaga--6fdc0d8d15ae6b4ebf45c52fd2aafbcbb19a65c8
+	testKeystoreAccountsPwd = "security123"
+	testChainID             = "the-blockchain-bar-test"
+)
 
 func TestSign(t *testing.T) {
 	privKey, err := ecdsa.GenerateKey(crypto.S256(), rand.Reader)
@@ -78,16 +81,16 @@ func TestSignTrxWithKeystoreAccount(t *testing.T) {
 		return
 	}
 
-	tx := db.NewTrx(andrej, babaYaga, 100, "")
+	tx := db.NewTrx(andrej, babaYaga, 100, 0, 1, "")
 
-	signedTrx, err := SignTrxWithKeystoreAccount(tx, andrej, testKeystoreAccountsPwd, GetKeystoreDirPath(tmpDir))
+	signedTrx, err := SignTrxWithKeystoreAccount(tx, andrej, testKeystoreAccountsPwd, GetKeystoreDirPath(tmpDir), testChainID)
 	if err != nil {
 		t.Error(err)
 		return
 	}
 
 	spew.Dump(signedTrx.Encode())
-	ok, err := signedTrx.IsAuthentic()
+	ok, err := signedTrx.IsAuthentic(testChainID)
 	if err != nil {
 		t.Error(err)
 		return
@@ -121,15 +124,15 @@ func TestSignForgedTxWithKeystoreAccount(t *testing.T) {
 		return
 	}
 
-	forgedTrx := db.NewTrx(babaYaga, hacker, 100, "")
+	forgedTrx := db.NewTrx(babaYaga, hacker, 100, 0, 1, "")
 
-	signedTrx, err := SignTrxWithKeystoreAccount(forgedTrx, hacker, testKeystoreAccountsPwd, GetKeystoreDirPath(tmpDir))
+	signedTrx, err := SignTrxWithKeystoreAccount(forgedTrx, hacker, testKeystoreAccountsPwd, GetKeystoreDirPath(tmpDir), testChainID)
 	if err != nil {
 		t.Error(err)
 		return
 	}
 
-	ok, err := signedTrx.IsAuthentic()
+	ok, err := signedTrx.IsAuthentic(testChainID)
 	if err != nil {
 		t.Error(err)
 		return
@@ -139,3 +142,34 @@ func TestSignForgedTxWithKeystoreAccount(t *testing.T) {
 		t.Fatal("the transaction 'from' attribute was forged and should have not be authentic")
 	}
 }
+
+func TestSignTrxIsBoundToChainID(t *testing.T) {
+	privKey, err := ecdsa.GenerateKey(crypto.S256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	from := crypto.PubkeyToAddress(privKey.PublicKey)
+	tx := db.NewTrx(from, db.NewAccount(AndrejAccount), 100, 0, 1, "")
+
+	signedTrx, err := SignTrx(tx, testChainID, privKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok, err := signedTrx.IsAuthentic(testChainID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("the transaction should be authentic on the chain it was signed for")
+	}
+
+	ok, err = signedTrx.IsAuthentic("another-tbb-network")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Fatal("the transaction signed for one chain should not be authentic on another")
+	}
+}